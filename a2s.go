@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"time"
+)
+
+// Source server query protocol: https://developer.valvesoftware.com/wiki/Server_queries
+
+const (
+	A2S_INFO = 0x54
+	A2S_PLAYER = 0x55
+	A2S_RULES = 0x56
+	S2A_INFO = 0x49
+	S2A_PLAYER = 0x44
+	S2A_RULES = 0x45
+	S2C_CHALLENGE = 0x41
+)
+
+const (
+	a2sTimeout = 3 * time.Second
+	// servers split replies that don't fit in a single packet of this size
+	a2sMaxPacketSize = 1400
+)
+
+var a2sHeader = []byte{0xFF, 0xFF, 0xFF, 0xFF}
+var a2sSplitHeader = []byte{0xFE, 0xFF, 0xFF, 0xFF}
+
+var (
+	ErrA2SUnexpectedFormat = errors.New("a2s: unexpected response format")
+	ErrA2SCompressed = errors.New("a2s: compressed responses are not supported")
+)
+
+type A2SInfo struct {
+	Protocol int
+	Name, Map, Folder, Game string
+	AppID int
+	Players, MaxPlayers, Bots int
+	ServerType, Environment byte
+	Password, VAC bool
+}
+
+type A2SPlayer struct {
+	Name string
+	Score int
+	Duration time.Duration
+}
+
+// QueryInfo sends an A2S_INFO query to a server, answering the challenge newer servers reply with.
+func QueryInfo(address string) (A2SInfo, error) {
+	request := append([]byte{A2S_INFO}, "Source Engine Query\x00"...)
+	response, err := a2sQuery(address, request, S2A_INFO)
+	if err != nil {
+		return A2SInfo{}, err
+	}
+	return parseInfo(response)
+}
+
+// QueryPlayers lists the players connected to a server. Players still connecting have an empty name.
+func QueryPlayers(address string) ([]A2SPlayer, error) {
+	request := append([]byte{A2S_PLAYER}, a2sHeader...)
+	response, err := a2sQuery(address, request, S2A_PLAYER)
+	if err != nil {
+		return nil, err
+	}
+	return parsePlayers(response)
+}
+
+// QueryRules returns the server's public cvars. CS:GO servers only answer it with host_rules_show 1.
+func QueryRules(address string) (map[string]string, error) {
+	request := append([]byte{A2S_RULES}, a2sHeader...)
+	response, err := a2sQuery(address, request, S2A_RULES)
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(response)
+}
+
+// a2sQuery sends a request and returns the payload of a reply of the expected type. If the server
+// replies with a challenge the request is sent again with it, A2S_PLAYER and A2S_RULES carry the
+// challenge in place of their 0xFFFFFFFF placeholder while A2S_INFO has it appended.
+func a2sQuery(address string, request []byte, responseType byte) ([]byte, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	response, err := a2sExchange(conn, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response[0] == S2C_CHALLENGE && len(response) >= 5 {
+		if request[0] == A2S_INFO {
+			request = append(request, response[1:5]...)
+		} else {
+			request = append([]byte{request[0]}, response[1:5]...)
+		}
+
+		response, err = a2sExchange(conn, request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if response[0] != responseType {
+		return nil, ErrA2SUnexpectedFormat
+	}
+	return response[1:], nil
+}
+
+// a2sExchange sends a request and reads the reply, reassembling it if the server split it across
+// several packets.
+func a2sExchange(conn net.Conn, request []byte) ([]byte, error) {
+	conn.SetDeadline(time.Now().Add(a2sTimeout))
+	if _, err := conn.Write(append(append([]byte{}, a2sHeader...), request...)); err != nil {
+		return nil, err
+	}
+
+	var parts [][]byte
+	received := 0
+
+	for {
+		buffer := make([]byte, a2sMaxPacketSize)
+		size, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		packet := buffer[:size]
+
+		if size >= 5 && bytes.Equal(packet[:4], a2sHeader) {
+			return packet[4:], nil
+		}
+
+		// split packets: ID, total number of packets, packet number and maximum packet size
+		if size < 12 || !bytes.Equal(packet[:4], a2sSplitHeader) {
+			return nil, ErrA2SUnexpectedFormat
+		}
+
+		if binary.LittleEndian.Uint32(packet[4:8]) & 0x80000000 != 0 {
+			return nil, ErrA2SCompressed
+		}
+
+		total, number := int(packet[8]), int(packet[9])
+		if parts == nil {
+			parts = make([][]byte, total)
+		}
+
+		if number >= len(parts) || total != len(parts) {
+			return nil, ErrA2SUnexpectedFormat
+		}
+
+		if parts[number] == nil {
+			parts[number] = packet[12:]
+			received++
+		}
+
+		if received == len(parts) {
+			payload := bytes.Join(parts, nil)
+			if len(payload) < 5 || !bytes.Equal(payload[:4], a2sHeader) {
+				return nil, ErrA2SUnexpectedFormat
+			}
+			return payload[4:], nil
+		}
+	}
+}
+
+func parseInfo(data []byte) (A2SInfo, error) {
+	info := A2SInfo{}
+	b := bytes.NewBuffer(data)
+
+	protocol, err := b.ReadByte()
+	if err != nil {
+		return info, ErrA2SUnexpectedFormat
+	}
+	info.Protocol = int(protocol)
+
+	for _, s := range []*string{&info.Name, &info.Map, &info.Folder, &info.Game} {
+		if *s, err = readString(b); err != nil {
+			return info, err
+		}
+	}
+
+	var fields struct {
+		AppID uint16
+		Players, MaxPlayers, Bots, ServerType, Environment, Visibility, VAC byte
+	}
+	if err = binary.Read(b, binary.LittleEndian, &fields); err != nil {
+		return info, ErrA2SUnexpectedFormat
+	}
+
+	info.AppID = int(fields.AppID)
+	info.Players = int(fields.Players)
+	info.MaxPlayers = int(fields.MaxPlayers)
+	info.Bots = int(fields.Bots)
+	info.ServerType = fields.ServerType
+	info.Environment = fields.Environment
+	info.Password = fields.Visibility == 1
+	info.VAC = fields.VAC == 1
+	return info, nil
+}
+
+func parsePlayers(data []byte) ([]A2SPlayer, error) {
+	b := bytes.NewBuffer(data)
+
+	count, err := b.ReadByte()
+	if err != nil {
+		return nil, ErrA2SUnexpectedFormat
+	}
+
+	players := []A2SPlayer{}
+	for i := 0; i < int(count); i++ {
+		if _, err = b.ReadByte(); err != nil { // index, always 0
+			return nil, ErrA2SUnexpectedFormat
+		}
+
+		player := A2SPlayer{}
+		if player.Name, err = readString(b); err != nil {
+			return nil, err
+		}
+
+		var fields struct {
+			Score int32
+			Duration float32
+		}
+		if err = binary.Read(b, binary.LittleEndian, &fields); err != nil {
+			return nil, ErrA2SUnexpectedFormat
+		}
+
+		player.Score = int(fields.Score)
+		if !math.IsNaN(float64(fields.Duration)) && fields.Duration > 0 {
+			player.Duration = time.Duration(float64(fields.Duration) * float64(time.Second))
+		}
+		players = append(players, player)
+	}
+	return players, nil
+}
+
+func parseRules(data []byte) (map[string]string, error) {
+	b := bytes.NewBuffer(data)
+
+	var count uint16
+	if err := binary.Read(b, binary.LittleEndian, &count); err != nil {
+		return nil, ErrA2SUnexpectedFormat
+	}
+
+	rules := make(map[string]string)
+	for i := 0; i < int(count); i++ {
+		name, err := readString(b)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := readString(b)
+		if err != nil {
+			return nil, err
+		}
+		rules[name] = value
+	}
+	return rules, nil
+}
+
+func readString(b *bytes.Buffer) (string, error) {
+	s, err := b.ReadString(0x00)
+	if err != nil {
+		return "", ErrA2SUnexpectedFormat
+	}
+	return s[:len(s)-1], nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+var testChallenge = []byte{0x11, 0x22, 0x33, 0x44}
+
+// startA2SServer answers every request it receives with the packets returned by respond.
+func startA2SServer(t *testing.T, respond func(request []byte) [][]byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen. Error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, a2sMaxPacketSize)
+		for {
+			size, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			for _, packet := range respond(append([]byte{}, buffer[:size]...)) {
+				conn.WriteTo(packet, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func a2sPacket(payload ...[]byte) []byte {
+	return bytes.Join(append([][]byte{a2sHeader}, payload...), nil)
+}
+
+func a2sSplitPacket(id uint32, total, number byte, payload []byte) []byte {
+	packet := append([]byte{}, a2sSplitHeader...)
+	packet = binary.LittleEndian.AppendUint32(packet, id)
+	packet = append(packet, total, number)
+	packet = binary.LittleEndian.AppendUint16(packet, a2sMaxPacketSize)
+	return append(packet, payload...)
+}
+
+// challenged replies with a challenge until the request carries it, then with response.
+func challenged(t *testing.T, challenged []byte, response [][]byte) func([]byte) [][]byte {
+	return func(request []byte) [][]byte {
+		if !bytes.HasPrefix(request, a2sHeader) {
+			t.Errorf("Request %x is missing the header", request)
+			return nil
+		}
+		if bytes.Equal(request, challenged) {
+			return response
+		}
+		return [][]byte{a2sPacket([]byte{S2C_CHALLENGE}, testChallenge)}
+	}
+}
+
+func infoPayload() []byte {
+	payload := []byte{S2A_INFO, 17}
+	payload = append(payload, "Test Server\x00de_dust2\x00csgo\x00Counter-Strike: Global Offensive\x00"...)
+	payload = binary.LittleEndian.AppendUint16(payload, 730)
+	return append(payload, 2, 12, 1, 'd', 'l', 1, 1)
+}
+
+func playersPayload() []byte {
+	payload := []byte{S2A_PLAYER, 2}
+	for _, name := range []string{"alice", ""} {
+		payload = append(payload, 0)
+		payload = append(payload, name+"\x00"...)
+		payload = binary.LittleEndian.AppendUint32(payload, 7)
+		payload = binary.LittleEndian.AppendUint32(payload, 0x42700000) // 60.0
+	}
+	return payload
+}
+
+func rulesPayload() []byte {
+	payload := []byte{S2A_RULES}
+	payload = binary.LittleEndian.AppendUint16(payload, 2)
+	return append(payload, "mp_maxrounds\x0030\x00sv_password\x001\x00"...)
+}
+
+func TestQueryInfoChallenge(t *testing.T) {
+	request := a2sPacket([]byte{A2S_INFO}, []byte("Source Engine Query\x00"), testChallenge)
+	address := startA2SServer(t, challenged(t, request, [][]byte{a2sPacket(infoPayload())}))
+
+	info, err := QueryInfo(address)
+	if err != nil {
+		t.Fatalf("QueryInfo failed. Error: %s", err)
+	}
+
+	expected := A2SInfo{Protocol: 17, Name: "Test Server", Map: "de_dust2", Folder: "csgo", Game: "Counter-Strike: Global Offensive",
+		AppID: 730, Players: 2, MaxPlayers: 12, Bots: 1, ServerType: 'd', Environment: 'l', Password: true, VAC: true}
+	if info != expected {
+		t.Errorf("QueryInfo returned %+v, expected %+v", info, expected)
+	}
+}
+
+func TestQueryPlayersChallenge(t *testing.T) {
+	request := a2sPacket([]byte{A2S_PLAYER}, testChallenge)
+	address := startA2SServer(t, challenged(t, request, [][]byte{a2sPacket(playersPayload())}))
+
+	players, err := QueryPlayers(address)
+	if err != nil {
+		t.Fatalf("QueryPlayers failed. Error: %s", err)
+	}
+
+	if len(players) != 2 || players[0].Name != "alice" || players[1].Name != "" {
+		t.Fatalf("QueryPlayers returned %+v", players)
+	}
+	if players[0].Score != 7 || players[0].Duration != time.Minute {
+		t.Errorf("QueryPlayers returned %+v, expected a score of 7 and a duration of 1m", players[0])
+	}
+}
+
+func TestQueryRulesSplit(t *testing.T) {
+	payload := a2sPacket(rulesPayload())
+	// sent out of order, with a duplicate, as UDP doesn't guarantee either
+	response := [][]byte{
+		a2sSplitPacket(1, 3, 2, payload[20:]),
+		a2sSplitPacket(1, 3, 0, payload[:10]),
+		a2sSplitPacket(1, 3, 0, payload[:10]),
+		a2sSplitPacket(1, 3, 1, payload[10:20]),
+	}
+	request := a2sPacket([]byte{A2S_RULES}, testChallenge)
+	address := startA2SServer(t, challenged(t, request, response))
+
+	rules, err := QueryRules(address)
+	if err != nil {
+		t.Fatalf("QueryRules failed. Error: %s", err)
+	}
+
+	if len(rules) != 2 || rules["mp_maxrounds"] != "30" || rules["sv_password"] != "1" {
+		t.Errorf("QueryRules returned %v", rules)
+	}
+}
+
+func TestQueryRulesCompressed(t *testing.T) {
+	response := [][]byte{a2sSplitPacket(0x80000001, 1, 0, a2sPacket(rulesPayload()))}
+	address := startA2SServer(t, func([]byte) [][]byte { return response })
+
+	if _, err := QueryRules(address); err != ErrA2SCompressed {
+		t.Errorf("QueryRules returned %v, expected %v", err, ErrA2SCompressed)
+	}
+}
+
+func TestQueryTruncated(t *testing.T) {
+	queries := []struct {
+		name string
+		payload []byte
+		query func(string) error
+	}{
+		{"QueryInfo", infoPayload(), func(address string) error { _, err := QueryInfo(address); return err }},
+		{"QueryPlayers", playersPayload(), func(address string) error { _, err := QueryPlayers(address); return err }},
+		{"QueryRules", rulesPayload(), func(address string) error { _, err := QueryRules(address); return err }},
+	}
+
+	for _, q := range queries {
+		// cut inside a string and inside the fixed size fields that follow one
+		for _, size := range []int{1, 8, len(q.payload) - 1} {
+			response := [][]byte{a2sPacket(q.payload[:size])}
+			address := startA2SServer(t, func([]byte) [][]byte { return response })
+
+			if err := q.query(address); err != ErrA2SUnexpectedFormat {
+				t.Errorf("%s with a reply cut to %d bytes returned %v, expected %v", q.name, size, err, ErrA2SUnexpectedFormat)
+			}
+		}
+	}
+}
+
+func TestQueryUnexpectedType(t *testing.T) {
+	address := startA2SServer(t, func([]byte) [][]byte { return [][]byte{a2sPacket(rulesPayload())} })
+
+	if _, err := QueryInfo(address); err != ErrA2SUnexpectedFormat {
+		t.Errorf("QueryInfo returned %v, expected %v", err, ErrA2SUnexpectedFormat)
+	}
+}
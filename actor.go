@@ -0,0 +1,35 @@
+package main
+
+import (
+	"time"
+)
+
+// The PUG and server registries, and the state of every server, are only touched from a single
+// goroutine. The chat transport and the log listeners hand their events to it with Do, so events
+// are handled one at a time in the order they arrived.
+var actions = make(chan func(), 100)
+
+func RunActions() {
+	for action := range actions {
+		action()
+		SaveState()
+	}
+}
+
+// Do runs action on the owner goroutine and waits for it to finish. It must not be called from
+// an action, use After to schedule more work.
+func Do(action func()) {
+	done := make(chan struct{})
+	actions <- func() {
+		action()
+		close(done)
+	}
+	<-done
+}
+
+// After runs action on the owner goroutine once d has passed, without blocking the caller.
+func After(d time.Duration, action func()) {
+	time.AfterFunc(d, func() {
+		actions <- action
+	})
+}
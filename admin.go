@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+func RegisterAdminCommands() {
+	RegisterCommand(&Command{Name: "endpug", Usage: "[#]", Permission: PERMISSION_ADMIN, Source: SOURCE_CHAT, Help: "Ends the PUG and frees its server.", Handler: cmdEndPug})
+	RegisterCommand(&Command{Name: "freeserver", Usage: "<server id>", MinArgs: 1, Permission: PERMISSION_ADMIN, Source: SOURCE_CHAT, Help: "Frees a server, ending any PUG on it.", Handler: cmdFreeServer})
+	RegisterCommand(&Command{Name: "setadmin", Usage: "[#] <nick>", MinArgs: 1, Permission: PERMISSION_ADMIN, Source: SOURCE_CHAT, Help: "Makes a player the PUG admin.", Handler: cmdSetAdmin})
+	RegisterCommand(&Command{Name: "kick", Usage: "[#] <nick>", MinArgs: 1, Permission: PERMISSION_ADMIN, Source: SOURCE_CHAT, Help: "Removes a player from the PUG.", Handler: cmdKick})
+	RegisterCommand(&Command{Name: "forcestart", Usage: "[#]", Permission: PERMISSION_ADMIN, Source: SOURCE_CHAT, Help: "Starts the PUG without waiting for 10 players.", Handler: cmdForceStart})
+	RegisterCommand(&Command{Name: "swap", Usage: "[#] <nick> <nick>", MinArgs: 2, Permission: PERMISSION_ADMIN, Source: SOURCE_CHAT, Help: "Swaps two players between the teams.", Handler: cmdSwap})
+}
+
+func LogAdminCommand(ctx *CommandContext) {
+	log.Printf("Admin command from %s in %s: %s\n", ctx.Hostmask, ctx.Channel, strings.Join(append([]string{Cmd(ctx.Command.Name)}, ctx.Args...), " "))
+}
+
+func cmdFreeServer(ctx *CommandContext) {
+	LogAdminCommand(ctx)
+	serverID, err := strconv.Atoi(ctx.Args[0])
+	cs, success := GetServerByID(serverID)
+	if err != nil || !success {
+		ctx.Reply("Unable to find server ID %s.", ctx.Args[0])
+		return
+	}
+
+	if pug, success := GetPugByID(cs.GetPugID()); success && cs.InUse {
+		ForceEndPug(pug)
+	} else {
+		cs.ReleaseServer()
+	}
+	ctx.Reply("Server %d has been freed.", serverID)
+}
+
+func cmdEndPug(ctx *CommandContext) {
+	LogAdminCommand(ctx)
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	ForceEndPug(pug)
+	ctx.Reply("PUG #%d has been ended by %s, type %s <map> to start a new one.", pug.GetNumber(), ctx.Nickname, Cmd("pug"))
+}
+
+func cmdSetAdmin(ctx *CommandContext) {
+	LogAdminCommand(ctx)
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	if !pug.SetAdmin(ctx.Args[0]) {
+		ctx.Reply("%s is not in the PUG.", ctx.Args[0])
+		return
+	}
+
+	ctx.Reply("%s has been assigned as the PUG admin.", ctx.Args[0])
+	if cs, success := GetServerByPugID(pug.GetPugID()); success && pug.PugActive() {
+		cs.ResetPugAdmin(pug)
+		SendPugDetails(pug, cs, ctx.Args[0])
+	}
+}
+
+func cmdKick(ctx *CommandContext) {
+	LogAdminCommand(ctx)
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	if !pug.LeavePug(ctx.Args[0]) {
+		ctx.Reply("%s is not in the PUG.", ctx.Args[0])
+		return
+	}
+
+	ctx.Reply("%s has been removed from the PUG by %s.", ctx.Args[0], ctx.Nickname)
+	if !pug.PugActive() {
+		HandlePlayerLeft(pug, ctx.Channel, ctx.Args[0])
+	} else if pug.GetAdmin() == ctx.Args[0] && pug.GetPlayerCount() > 0 {
+		pug.AssignNewAdmin()
+		ctx.Reply("%s has been asigned as the PUG admin.", pug.GetAdmin())
+		if cs, success := GetServerByPugID(pug.GetPugID()); success {
+			cs.ResetPugAdmin(pug)
+			SendPugDetails(pug, cs, pug.GetAdmin())
+		}
+	}
+}
+
+func cmdForceStart(ctx *CommandContext) {
+	LogAdminCommand(ctx)
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	if pug.PugActive() {
+		ctx.Reply("The PUG has already started.")
+		return
+	}
+
+	if pug.GetPlayerCount() < 2 {
+		ctx.Reply("At least 2 players are needed to force start the PUG.")
+		return
+	}
+
+	ctx.Reply("PUG #%d has been force started by %s with %d players! The server information will be messaged to you.", pug.GetNumber(), ctx.Nickname, pug.GetPlayerCount())
+	ActivatePug(pug)
+}
+
+func cmdSwap(ctx *CommandContext) {
+	LogAdminCommand(ctx)
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	if !pug.SwapPlayers(ctx.Args[0], ctx.Args[1]) {
+		ctx.Reply("Both %s and %s must be in the PUG.", ctx.Args[0], ctx.Args[1])
+		return
+	}
+
+	players := pug.GetPlayers()
+	half := (len(players) + 1) / 2
+	ctx.Reply("%s and %s have been swapped.", ctx.Args[0], ctx.Args[1])
+	if pug.PugActive() {
+		ctx.Reply("The teams are as follows. Terrorists: %s Counter-Terrorists: %s", strings.Join(players[0:half], " "), strings.Join(players[half:], " "))
+	}
+}
+
+// ForceEndPug ends a PUG regardless of its state and frees the server assigned to it.
+func ForceEndPug(pug *PUG) {
+	pugID := pug.GetPugID()
+	pug.EndPug()
+	DeletePug(pugID)
+
+	cs, success := GetServerByPugID(pugID)
+	if !success {
+		return
+	}
+
+	cs.WriteData("_restart")
+	cs.WriteData("sv_password %s", pug.GenerateRandomPassword("temp"))
+	cs.ReleaseServer()
+}
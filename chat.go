@@ -0,0 +1,15 @@
+package main
+
+var chat ChatTransport
+
+// ChatTransport is the chat network the PUGs are organised on. A transport delivers channel
+// messages to HandleChatCommand and reports nickname changes and departures through
+// HandleChatNickChange and HandleChatPart.
+type ChatTransport interface {
+	SendToChannel(channel, data string, v ...interface{})
+	SendPrivate(nickname, data string, v ...interface{})
+	// IsPrivileged reports whether a user may use the admin commands in a channel.
+	IsPrivileged(channel, nickname, hostmask string) bool
+	// Run connects the transport and delivers chat events until the bot exits.
+	Run()
+}
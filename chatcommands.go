@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SteamIDs are shown as STEAM_1:0:12345 by CS:GO and as [U:1:24690] by CS2
+var steamIDRegex = regexp.MustCompile(`^(?:STEAM_[0-5]:[01]:[0-9]+|\[U:1:[0-9]+\])$`)
+
+// HandleChatCommand handles a message sent to a channel by a user of the chat transport.
+func HandleChatCommand(destination, nickname, hostmask string, message []string) {
+	ctx := &CommandContext{Source: SOURCE_CHAT, Channel: destination, Nickname: nickname, Hostmask: hostmask}
+
+	if chat.IsPrivileged(destination, nickname, hostmask) {
+		ctx.Level = PERMISSION_ADMIN
+	} else if pug, success := GetActivePugByPlayer(nickname); success && pug.GetIRCChannel() == destination && pug.IsCaptain(nickname) {
+		ctx.Level = PERMISSION_CAPTAIN
+	}
+	DispatchCommand(ctx, message)
+}
+
+func RegisterChatCommands() {
+	RegisterCommand(&Command{Name: "pug", Usage: "[map]", Source: SOURCE_CHAT, Help: "Starts a new PUG on the given map.", Handler: cmdPug})
+	RegisterCommand(&Command{Name: "join", Usage: "[#]", Source: SOURCE_CHAT, Help: "Joins a PUG in this channel.", Handler: cmdJoin})
+	RegisterCommand(&Command{Name: "leave", Usage: "[#]", Source: SOURCE_CHAT, Help: "Leaves your PUG in this channel.", Handler: cmdLeave})
+	RegisterCommand(&Command{Name: "stats", Source: SOURCE_CHAT, Help: "Links to your player stats.", Handler: cmdChatStats})
+	RegisterCommand(&Command{Name: "players", Source: SOURCE_CHAT, Help: "Lists the players in each PUG in this channel.", Handler: cmdPlayers})
+	RegisterCommand(&Command{Name: "link", Usage: "[#] <SteamID>", MinArgs: 1, Source: SOURCE_CHAT, Help: "Links your SteamID so you are recognised in-game, for example " + Cmd("link") + " STEAM_1:0:12345.", Handler: cmdLink})
+	RegisterCommand(&Command{Name: "servers", Source: SOURCE_CHAT, Help: "Lists the servers and their health.", Handler: cmdServers})
+	RegisterCommand(&Command{Name: "say", Usage: "[#] <message>", MinArgs: 1, Source: SOURCE_CHAT, Help: "Sends a message to the PUG server.", Handler: cmdSay})
+}
+
+// GetCommandPug returns the PUG a command issued in a channel refers to. A PUG number may be given
+// before the command's own arguments, otherwise the only PUG in the channel or the one the user is
+// in is used. A number without a # that isn't a PUG is left as an argument, as in "!say 5 more
+// minutes". The user is told what went wrong if no PUG could be chosen.
+func GetCommandPug(ctx *CommandContext) (*PUG, bool) {
+	pugs := GetPugsByChannel(ctx.Channel)
+	if len(pugs) == 0 {
+		ctx.Reply("A PUG has not been started, type %s <map> to start a new one.", Cmd("pug"))
+		return nil, false
+	}
+
+	if len(ctx.Args) > ctx.Command.MinArgs {
+		if number, err := strconv.Atoi(strings.TrimPrefix(ctx.Args[0], "#")); err == nil {
+			pug, success := GetPugByNumber(ctx.Channel, number)
+			if success {
+				ctx.Args = ctx.Args[1:]
+				return pug, true
+			}
+
+			if strings.HasPrefix(ctx.Args[0], "#") {
+				ctx.Reply("PUG #%d does not exist, type %s to see the PUGs in this channel.", number, Cmd("players"))
+				return nil, false
+			}
+		}
+	}
+
+	if len(pugs) == 1 {
+		return pugs[0], true
+	}
+
+	var queued []*PUG
+	for _, pug := range GetPugsByPlayer(ctx.Nickname) {
+		if pug.GetIRCChannel() == ctx.Channel {
+			queued = append(queued, pug)
+		}
+	}
+	if len(queued) == 1 {
+		return queued[0], true
+	}
+
+	ctx.Reply("There are %d PUGs in this channel, please include the PUG number, e.g. %s %d.", len(pugs), Cmd(ctx.Command.Name), pugs[len(pugs)-1].GetNumber())
+	return nil, false
+}
+
+func cmdPug(ctx *CommandContext) {
+	if pug, success := GetActivePugByPlayer(ctx.Nickname); success {
+		ctx.Reply("%s, you are already playing in PUG #%d in %s.", ctx.Nickname, pug.GetNumber(), pug.GetIRCChannel())
+		return
+	}
+
+	cs, success := GetFreeServer("Sydney") // to-do - obtain channel region
+		
+	if !success {
+		ctx.Reply("Unable to discover any available servers with specified region.")
+		return
+	}
+
+	p := &PUG{}
+
+	if len(ctx.Args) > 0 {
+		s := ctx.Args[0]
+		if !IsValidMap(s) {
+			p.SetMap("de_dust2")
+		} else {
+			p.SetMap(s)
+		}
+	}
+
+	p.StartPug()
+	p.SetIRCChannel(ctx.Channel)
+	p.JoinPug(ctx.Nickname)
+	NewPug(p)
+
+	cs.SetInUseStatus(true)
+	cs.SetIRCChannel(ctx.Channel)
+	cs.SetPugID(p.GetPugID())
+
+	ctx.Reply("PUG #%d has been started on map %s, type %s %d to join the pug", p.GetNumber(), p.GetMap(), Cmd("join"), p.GetNumber())
+	log.Printf("Assigned server ID, region %s to pug ID %d with channel %s\n", cs.GetRegion(), p.GetPugID(), ctx.Channel)
+	cs.WriteData("changelevel %s", p.GetMap())
+	cs.serverPassword = p.GenerateRandomPassword("pug")
+	cs.WriteData("sv_password %s", cs.serverPassword)
+	cs.pugAdminPassword = p.GenerateRandomPassword("admin")
+}
+
+func cmdJoin(ctx *CommandContext) {
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	if current, success := GetActivePugByPlayer(ctx.Nickname); success && current != pug {
+		ctx.Reply("%s, you are already playing in PUG #%d in %s.", ctx.Nickname, current.GetNumber(), current.GetIRCChannel())
+		return
+	}
+
+	if pug.JoinPug(ctx.Nickname) && !pug.PugActive() {
+		ctx.Reply("%s has joined PUG #%d! [%d/10]", ctx.Nickname, pug.GetNumber(), pug.GetPlayerCount())
+		if pug.GetPlayerCount() < 10 {
+			return
+		}
+		ctx.Reply("PUG #%d is now full! The server information will be messaged to you.", pug.GetNumber())
+		ActivatePug(pug)
+	}
+}
+
+func cmdLeave(ctx *CommandContext) {
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	if pug.LeavePug(ctx.Nickname) && !pug.PugActive() {
+		HandlePlayerLeft(pug, ctx.Channel, ctx.Nickname)
+	}
+}
+
+func cmdChatStats(ctx *CommandContext) {
+	ctx.Reply("Stats for player %s can be visited here: http://www.cs-stats.com/player/xxxxxx", ctx.Nickname)
+}
+
+func cmdPlayers(ctx *CommandContext) {
+	pugs := GetPugsByChannel(ctx.Channel)
+	sort.Slice(pugs, func(i, j int) bool { return pugs[i].GetNumber() < pugs[j].GetNumber() })
+
+	for _, pug := range pugs {
+		pug := pug
+		GetPlayersWithPing(pug, func(players []string) {
+			status := "waiting for players"
+			if pug.PugActive() {
+				status = "in progress"
+			}
+			ctx.Reply("PUG #%d (%s, %s) player list: %s [%d/10]", pug.GetNumber(), pug.GetMap(), status, strings.Join(players, " "), pug.GetPlayerCount())
+		})
+	}
+}
+
+// GetPlayersWithPing lists the players of a PUG, adding the ping of linked players connected to the
+// server once the PUG is active. The server is queried without blocking, so the list is passed to
+// callback, which runs straight away if there's nothing to query.
+func GetPlayersWithPing(pug *PUG, callback func(players []string)) {
+	cs, success := GetServerByPugID(pug.GetPugID())
+	if !pug.PugActive() || !success {
+		callback(append([]string{}, pug.GetPlayers()...))
+		return
+	}
+
+	cs.QueryStatus(func(status ServerStatus, err error) {
+		players := append([]string{}, pug.GetPlayers()...)
+		if err != nil {
+			log.Printf("Unable to get the status of %s. Error: %s\n", cs.serverIP, err)
+			callback(players)
+			return
+		}
+
+		for i := range players {
+			if steamID, linked := pug.GetSteamID(players[i]); linked {
+				if player, connected := status.GetPlayerBySteamID(steamID); connected {
+					players[i] += fmt.Sprintf(" (%dms)", player.Ping)
+				}
+			}
+		}
+		callback(players)
+	})
+}
+
+func cmdLink(ctx *CommandContext) {
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	if !steamIDRegex.MatchString(ctx.Args[0]) {
+		ctx.Reply("Usage: %s, for example %s STEAM_1:0:12345 or %s [U:1:24690]", GetCommandUsage(ctx.Command), Cmd("link"), Cmd("link"))
+		return
+	}
+
+	if !pug.LinkSteamID(ctx.Nickname, ctx.Args[0]) {
+		ctx.Reply("Unable to link %s, you must be in the PUG and the SteamID must not be linked to another player.", ctx.Args[0])
+		return
+	}
+	ctx.Reply("%s has been linked to %s.", ctx.Nickname, ctx.Args[0])
+}
+
+func cmdServers(ctx *CommandContext) {
+	for i := range csManager {
+		ctx.Reply("%s", csManager[i].GetHealthSummary())
+	}
+}
+
+func cmdSay(ctx *CommandContext) {
+	pug, success := GetCommandPug(ctx)
+	if !success {
+		return
+	}
+
+	cs, success := GetServerByPugID(pug.GetPugID())
+	
+	if !success {
+		log.Println("Unable to find server")
+		return
+	}
+
+	s := strings.Join(ctx.Args, " ")
+	cs.Say("[IRC] %s", s)
+	ctx.Reply("Sent message to CS server.")
+}
+
+// HandleChatNickChange keeps the PUG rosters up to date when a user changes nickname.
+func HandleChatNickChange(oldNick, newNick string) {
+	for _, pug := range GetPugsByPlayer(oldNick) {
+		pug.UpdatePlayerNickname(oldNick, newNick)
+	}
+}
+
+// HandleChatPart removes a user from the PUGs of a channel when they leave it, channel is empty
+// when the user quit the chat network.
+func HandleChatPart(channel, nickname string) {
+	for _, pug := range GetPugsByPlayer(nickname) {
+		if len(channel) > 0 && pug.GetIRCChannel() != channel {
+			continue
+		}
+
+		if pug.LeavePug(nickname) && !pug.PugActive() {
+			HandlePlayerLeft(pug, pug.GetIRCChannel(), nickname)
+		}
+	}
+}
+
+func ActivatePug(pug *PUG) {
+	cs, _ := GetServerByPugID(pug.GetPugID())
+	pug.RandomisePlayerList()
+	pug.SetPugActive(true)
+
+	players := pug.GetPlayers()
+	half := (len(players) + 1) / 2
+	cs.SendToChannel("The teams are as follows. Terrorists: %s Counter-Terrorists: %s", strings.Join(players[0:half], " "), strings.Join(players[half:], " "))
+	pug.SetCaptains()
+	cs.SendToChannel("The captains are %s (Terrorists) and %s (Counter-Terrorists). Type %s <SteamID> so you are recognised in-game.", pug.GetCaptainT(), pug.GetCaptainCT(), Cmd("link"))
+	cs.WriteData("mp_maxrounds 999")
+
+	for i := range players {
+		SendPugDetails(pug, cs, players[i])
+	}
+	RemoveFromOtherQueues(pug)
+}
+
+// RemoveFromOtherQueues takes the players of a PUG that has gone active out of the other PUGs they
+// queued for.
+func RemoveFromOtherQueues(pug *PUG) {
+	for _, player := range pug.GetPlayers() {
+		for _, other := range GetPugsByPlayer(player) {
+			if other == pug || other.PugActive() || !other.LeavePug(player) {
+				continue
+			}
+
+			cs, _ := GetServerByPugID(other.GetPugID())
+			cs.SendToChannel("%s has been removed from the queue as their PUG in %s has started. [%d/10]", player, pug.GetIRCChannel(), other.GetPlayerCount())
+			if other.GetPlayerCount() == 0 || other.GetAdmin() == player {
+				HandlePlayerLeft(other, other.GetIRCChannel(), player)
+			}
+		}
+	}
+}
+
+// HandlePlayerLeft announces a player leaving a PUG that hasn't gone active, handing the admin rights
+// to another player or ending the PUG once it is empty.
+func HandlePlayerLeft(pug *PUG, channel, nickname string) {
+	cs, _ := GetServerByPugID(pug.GetPugID())
+	if pug.GetPlayerCount() == 0 {
+		cs.SendToChannel("The PUG admin has left the PUG and there are no other plays to assign the admin rights to. Type %s <map> to start a new one.", Cmd("pug"))
+		pug.EndPug()
+		DeletePug(pug.GetPugID())
+		cs.ReleaseServer()
+	} else {
+		if pug.GetAdmin() == nickname {
+			pug.AssignNewAdmin()
+			cs.SendToChannel("The PUG administrator has left the pug and %s has been asigned as the PUG admin.", pug.GetAdmin())
+		} else {
+			cs.SendToChannel("%s has left the pug, [%d/10]", nickname, pug.GetPlayerCount())
+		}
+	}
+}
+
+func SendPugDetails(pug *PUG, cs *CS, player string) {
+	if player == pug.GetAdmin() {
+		chat.SendPrivate(player, "PUG details are: connect %s; password %s. PUG Admin password: %s (type %s <password> in game and %s once all players are ready).", cs.serverIP, cs.serverPassword, cs.pugAdminPassword, Cmd("login"), Cmd("lo3"))
+	} else {
+		chat.SendPrivate(player, "PUG details are: connect %s; password %s.", cs.serverIP, cs.serverPassword)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	SOURCE_CHAT = 1 << iota
+	SOURCE_GAME
+	SOURCE_BOTH = SOURCE_CHAT | SOURCE_GAME
+)
+
+var commandPrefix = "!"
+var commands []*Command
+
+type Command struct {
+	Name string
+	Aliases []string
+	// Usage describes the arguments, e.g. "<nick> [map]"
+	Usage string
+	MinArgs int
+	Permission int
+	Source int
+	Help string
+	Handler func(ctx *CommandContext)
+}
+
+// CommandContext describes who issued a command and where from. Commands issued in-game
+// carry the server, SteamID and team of the player, Channel is then the server's PUG channel.
+type CommandContext struct {
+	Source int
+	Command *Command
+	Args []string
+	Channel, Nickname, Hostmask string
+	SteamID, Team string
+	CS *CS
+	Level int
+}
+
+func SetCommandPrefix(prefix string) {
+	if len(prefix) > 0 {
+		commandPrefix = prefix
+	}
+}
+
+// Cmd returns a command name with the configured prefix, for use in messages to players.
+func Cmd(name string) string {
+	return commandPrefix + name
+}
+
+func RegisterCommand(cmd *Command) {
+	commands = append(commands, cmd)
+}
+
+func FindCommand(name string, source int) (*Command, bool) {
+	name = strings.ToLower(name)
+	for i := range commands {
+		if commands[i].Source & source == 0 {
+			continue
+		}
+
+		if commands[i].Name == name {
+			return commands[i], true
+		}
+
+		for j := range commands[i].Aliases {
+			if commands[i].Aliases[j] == name {
+				return commands[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// DispatchCommand runs the command in message if it is one, checking the permission level and
+// number of arguments first. Messages that aren't commands are ignored.
+func DispatchCommand(ctx *CommandContext, message []string) {
+	if len(message) == 0 || !strings.HasPrefix(message[0], commandPrefix) || len(message[0]) == len(commandPrefix) {
+		return
+	}
+
+	cmd, success := FindCommand(message[0][len(commandPrefix):], ctx.Source)
+	if !success {
+		return
+	}
+
+	ctx.Command = cmd
+	ctx.Args = message[1:]
+
+	if ctx.Level < cmd.Permission {
+		log.Printf("%s does not have permission to use %s\n", ctx.Nickname, Cmd(cmd.Name))
+		ctx.Reply("%s, you do not have permission to use %s.", ctx.Nickname, Cmd(cmd.Name))
+		return
+	}
+
+	if len(ctx.Args) < cmd.MinArgs {
+		ctx.ReplyUsage()
+		return
+	}
+
+	cmd.Handler(ctx)
+}
+
+// Reply answers a command in the place it was issued from.
+func (ctx *CommandContext) Reply(data string, v ...interface{}) {
+	if ctx.Source == SOURCE_GAME {
+		ctx.CS.Say(data, v...)
+	} else {
+		chat.SendToChannel(ctx.Channel, data, v...)
+	}
+}
+
+func (ctx *CommandContext) ReplyUsage() {
+	ctx.Reply("Usage: %s", GetCommandUsage(ctx.Command))
+}
+
+func GetCommandUsage(cmd *Command) string {
+	if len(cmd.Usage) == 0 {
+		return Cmd(cmd.Name)
+	}
+	return Cmd(cmd.Name) + " " + cmd.Usage
+}
+
+func RegisterHelpCommand() {
+	RegisterCommand(&Command{
+		Name: "help",
+		Usage: "[command]",
+		Source: SOURCE_BOTH,
+		Help: "Lists the available commands, or describes a command.",
+		Handler: cmdHelp,
+	})
+}
+
+func cmdHelp(ctx *CommandContext) {
+	if len(ctx.Args) > 0 {
+		cmd, success := FindCommand(strings.TrimPrefix(ctx.Args[0], commandPrefix), ctx.Source)
+		if !success {
+			ctx.Reply("Unknown command %s, type %s for a list of commands.", ctx.Args[0], Cmd("help"))
+			return
+		}
+
+		help := GetCommandUsage(cmd) + " - " + cmd.Help
+		if len(cmd.Aliases) > 0 {
+			help += " Aliases: " + commandPrefix + strings.Join(cmd.Aliases, " " + commandPrefix)
+		}
+		ctx.Reply("%s", help)
+		return
+	}
+
+	var names []string
+	for i := range commands {
+		if commands[i].Source & ctx.Source != 0 && ctx.Level >= commands[i].Permission {
+			names = append(names, Cmd(commands[i].Name))
+		}
+	}
+	sort.Strings(names)
+	ctx.Reply("Commands: %s. Type %s <command> for details.", strings.Join(names, " "), Cmd("help"))
+}
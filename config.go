@@ -6,12 +6,26 @@ import (
 )
 
 type Config struct {
+	ChatTransport string
+	CommandPrefix string
 	IRCServer string
 	IRCPassword string
 	IRCChannels []Channels
 	IRCNickname string
 	IRCUsername string
+	IRCAdmins []string
+	IRCTLS bool
+	IRCTLSSkipVerify bool
+	IRCTLSCertFile string
+	IRCTLSKeyFile string
+	IRCSASLMechanism string
+	IRCSASLUsername string
+	IRCSASLPassword string
+	IRCNickServPassword string
+	IRCNickServRecover string
 	CSServers []CSServers
+	CSLogListenAddress string
+	CSLogHTTPListenAddress string
 	CSMaps string
 	TeamNames string
 	CSDefaultPugAdminPassword string
@@ -27,6 +41,8 @@ type CSServers struct {
 	Server string
 	RconPassword string
 	ListenAddress string
+	LogAddress string
+	HTTPLog bool
 	DefaultPugAdminPassword string
 	Region string
 	Log bool
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Console is a chat transport reading from standard input, used for testing the bot without an
+// IRC server. Each line is "<channel> <nickname> <message>", or one of "/nick <old> <new>",
+// "/part <channel> <nickname>" and "/quit <nickname>".
+type Console struct {
+}
+
+func (c *Console) SendToChannel(channel, data string, v ...interface{}) {
+	fmt.Printf("[%s] %s\n", channel, fmt.Sprintf(data, v...))
+}
+
+func (c *Console) SendPrivate(nickname, data string, v ...interface{}) {
+	fmt.Printf("[-> %s] %s\n", nickname, fmt.Sprintf(data, v...))
+}
+
+func (c *Console) IsPrivileged(channel, nickname, hostmask string) bool {
+	return true
+}
+
+func (c *Console) Run() {
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+			case fields[0] == "/nick" && len(fields) == 3:
+				Do(func() { HandleChatNickChange(fields[1], fields[2]) })
+			case fields[0] == "/part" && len(fields) == 3:
+				Do(func() { HandleChatPart(fields[1], fields[2]) })
+			case fields[0] == "/quit" && len(fields) == 2:
+				Do(func() { HandleChatPart("", fields[1]) })
+			case strings.HasPrefix(fields[0], "#") && len(fields) > 2:
+				Do(func() { HandleChatCommand(fields[0], fields[1], fields[1] + "!console@localhost", fields[2:]) })
+			default:
+				fmt.Println("Usage: <channel> <nickname> <message> | /nick <old> <new> | /part <channel> <nickname> | /quit <nickname>")
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Unable to read from the console. Error: %s\n", err)
+	}
+}
@@ -1,30 +1,41 @@
 package main
 
 import (
-	"errors"
 	"net"
 	"log"
 	"fmt"
 	"strings"
-	"strconv"
 	"time"
 )
 
 var csManager []*CS
+var nextServerID int
+var sharedLogAddress string
+
+const (
+	PERMISSION_PLAYER = iota
+	PERMISSION_CAPTAIN
+	PERMISSION_ADMIN
+)
 
 type CS struct {
 	pugID int
 	serverID int
-	InUse, DumpProtocolMessages, RelayGameEvents bool
+	InUse, DumpProtocolMessages, RelayGameEvents, httpLog bool
 	SrvSocket *net.UDPConn
-	rc RemoteConsole
+	serverAddr *net.UDPAddr
+	rcon *RconSession
 	sm ScoreManager
-	serverIP, rconPassword, localIP, serverPassword, listenAddress, region, pugAdminPassword, authSteamID, ircChannel, externalIP string
+	pm PauseManager
+	health ServerHealth
+	// the side each player was last seen on in the logs, by SteamID
+	teams map[string]string
+	serverIP, rconPassword, localIP, serverPassword, listenAddress, region, pugAdminPassword, authSteamID, ircChannel, externalIP, logSecret, logToken, logAddress, enabledLogAddress string
 }
 
 func GetFreeServer(region string) (*CS, bool) {
 	for i := range csManager {
-		if !csManager[i].InUse && csManager[i].region == region {
+		if !csManager[i].InUse && csManager[i].region == region && csManager[i].IsHealthy() {
 			return csManager[i], true
 		}
 	}
@@ -40,20 +51,63 @@ func GetServerByID(serverID int) (*CS, bool) {
 	return nil, false
 }
 
-func GetServerByChannel(channel string) (*CS, bool) {
+func GetServerByIP(serverIP string) (*CS, bool) {
+	for i := range csManager {
+		if csManager[i].serverIP == serverIP {
+			return csManager[i], true
+		}
+	}
+	return nil, false
+}
+
+func GetServerByPugID(pugID int) (*CS, bool) {
 	for i := range csManager {
-		if csManager[i].ircChannel == channel {
+		if csManager[i].InUse && csManager[i].pugID == pugID {
 			return csManager[i], true
 		}
 	}
 	return nil, false
 }
 
-func SetupAndTestCSServers(csServers []CSServers) (bool) {
+func SetupAndTestCSServers(csServers []CSServers, logListenAddress, httpLogListenAddress string) (bool) {
 	success := 0
 
+	if len(httpLogListenAddress) > 0 && !StartHTTPLogServer(httpLogListenAddress) {
+		log.Fatalf("Unable to bind the HTTP log server %s", httpLogListenAddress)
+		return false
+	}
+
+	if len(logListenAddress) > 0 {
+		socket, started := StartUDPServer(logListenAddress)
+		if !started {
+			log.Fatalf("Unable to bind the shared log listener %s", logListenAddress)
+			return false
+		}
+		sharedLogAddress = logListenAddress
+		go RecvData(socket, nil)
+	}
+
 	for i := 0; i < len(csServers); i++ {
-		if NewCSServer(csServers[i].Server, csServers[i].RconPassword, "", csServers[i].ListenAddress, csServers[i].Region, "", csServers[i].Log) {
+		listenAddress := csServers[i].ListenAddress
+		if csServers[i].HTTPLog {
+			if len(httpLogAddress) == 0 {
+				log.Printf("Server %s logs over HTTP and there is no csLogHTTPListenAddress, skipping it.\n", csServers[i].Server)
+				continue
+			}
+			listenAddress = httpLogAddress
+		} else if len(listenAddress) == 0 {
+			if len(sharedLogAddress) == 0 {
+				log.Printf("Server %s has no ListenAddress and there is no shared csLogListenAddress, skipping it.\n", csServers[i].Server)
+				continue
+			}
+			listenAddress = sharedLogAddress
+		}
+
+		if !ProbeServer(csServers[i].Server) {
+			continue
+		}
+
+		if NewCSServer(csServers[i].Server, csServers[i].RconPassword, "", listenAddress, csServers[i].LogAddress, csServers[i].Region, "", csServers[i].HTTPLog, csServers[i].Log) {
 			success++
 		}
 	}
@@ -65,31 +119,60 @@ func SetupAndTestCSServers(csServers []CSServers) (bool) {
 	return true
 }
 
+// ProbeServer checks that a server answers server queries before the bot takes it over.
+func ProbeServer(serverIP string) bool {
+	info, err := QueryInfo(serverIP)
+	if err != nil {
+		log.Printf("Server %s did not answer the server query, skipping it. Error: %s\n", serverIP, err)
+		return false
+	}
+
+	log.Printf("Found server %s: \"%s\" on %s with %d/%d players (password: %t, VAC: %t)\n", serverIP, info.Name, info.Map, info.Players, info.MaxPlayers, info.Password, info.VAC)
+	return true
+}
+
 func GetCSServerCount() (int) {
 	return len(csManager)
 }
 
-func NewCSServer(serverIP, rconPassword, serverPassword, listenAddress, region, ircChannel string, DumpProtocolMessages bool) (bool) {
+func NewCSServer(serverIP, rconPassword, serverPassword, listenAddress, logAddress, region, ircChannel string, httpLog, DumpProtocolMessages bool) (bool) {
 	cs := &CS{}
 
-	if (len(csManager) == 0) {
-		cs.serverID = 0
-	} else {
-		cs.serverID = len(csManager)
-	}
+	cs.serverID = nextServerID
+	nextServerID++
 
 	cs.serverIP = serverIP
 	cs.rconPassword = rconPassword
+	cs.rcon = NewRconSession(cs)
+
+	var err error
+	cs.serverAddr, err = net.ResolveUDPAddr("udp", serverIP)
+	if err != nil {
+		log.Printf("Unable to resolve server address %s. Error: %s\n", serverIP, err)
+		return false
+	}
 
 	if !cs.ConnectToRcon() {
 		log.Fatalf("Unable to connect to CS server %s\n", serverIP)
 		return false
 	}
 
+	// servers without a dedicated listener log to the shared one or over HTTP
 	cs.listenAddress = listenAddress
-	if !cs.StartUDPServer() {
-		log.Fatalf("Unable to bind UDP server %s", listenAddress)
-		return false
+	cs.httpLog = httpLog
+	if listenAddress != sharedLogAddress && !httpLog {
+		var started bool
+		if cs.SrvSocket, started = StartUDPServer(listenAddress); !started {
+			log.Fatalf("Unable to bind UDP server %s", listenAddress)
+			return false
+		}
+	}
+
+	// a LogAddress without a port uses the listener's port, e.g. when a forwarded port keeps its number
+	cs.logAddress = logAddress
+	if _, _, err := net.SplitHostPort(logAddress); len(logAddress) > 0 && err != nil {
+		_, port, _ := net.SplitHostPort(listenAddress)
+		cs.logAddress = net.JoinHostPort(logAddress, port)
 	}
 
 	cs.region = region
@@ -98,9 +181,18 @@ func NewCSServer(serverIP, rconPassword, serverPassword, listenAddress, region,
 	cs.RelayGameEvents = false
 	cs.DumpProtocolMessages = DumpProtocolMessages
 	cs.ircChannel = ircChannel
+	cs.logSecret = GenerateLogSecret()
+	cs.logToken = GenerateLogToken()
 
 	cs.EnableLogging()
-	go cs.RecvData()
+	cs.health.healthy = true
+	cs.health.lastLog = time.Now()
+	cs.TestLogging()
+	go cs.rcon.Run()
+	if cs.SrvSocket != nil {
+		go RecvData(cs.SrvSocket, cs)
+	}
+	go cs.CheckHealth()
 	csManager = append(csManager, cs)
 	return true
 }
@@ -134,127 +226,203 @@ func (cs *CS) GetIRCChannel() (string) {
 	return cs.ircChannel
 }
 
+func (cs *CS) SetPugID(pugID int) {
+	cs.pugID = pugID
+}
+
+func (cs *CS) GetPugID() (int) {
+	return cs.pugID
+}
+
+// SendToChannel sends a message to the channel of the PUG on the server, naming the PUG when the
+// channel has more than one.
+func (cs *CS) SendToChannel(data string, v ...interface{}) {
+	if pug, success := GetPugByID(cs.pugID); success && len(GetPugsByChannel(cs.ircChannel)) > 1 {
+		data = fmt.Sprintf("[PUG #%d] ", pug.GetNumber()) + data
+	}
+	chat.SendToChannel(cs.ircChannel, data, v...)
+}
+
 func (cs *CS) GetServerID() (int) {
 	return cs.serverID
 }
 
-func (cs *CS) StartUDPServer() bool {
-	log.Printf("Starting UDP server on %s", cs.listenAddress)
-	addr, err := net.ResolveUDPAddr("udp", cs.listenAddress)
+func StartUDPServer(listenAddress string) (*net.UDPConn, bool) {
+	log.Printf("Starting UDP server on %s", listenAddress)
+	addr, err := net.ResolveUDPAddr("udp", listenAddress)
 
 	if err != nil {
 		log.Fatal("Unable to resolve listen address.")
-		return false
+		return nil, false
 	}
 
-	cs.SrvSocket, err = net.ListenUDP("udp", addr)
+	socket, err := net.ListenUDP("udp", addr)
 
 	if err != nil {
 		log.Printf("Unable to listen.")
-		return false
+		return nil, false
 	}
 
 	log.Println("UDP server started successfully")
-	return true
+	return socket, true
 }
 
 func (cs *CS) EnableLogging() {
-	// to-do: check if cs server IP is private and use internal ip, otherwise use external ip
-	port, _ := strconv.Atoi(strings.Split(cs.listenAddress, ":")[1]) 
-	cs.WriteData("logaddress_add %s:%d", cs.localIP, port)
+	address, previous := cs.GetLogAddress(), cs.enabledLogAddress
+	changed := len(previous) > 0 && previous != address
+	log.Printf("Server %s will send its logs to %s\n", cs.serverIP, address)
+	cs.enabledLogAddress = address
+
+	if cs.httpLog {
+		// CS2 can only remove all of its HTTP log addresses
+		if changed {
+			cs.WriteData("logaddress_delall_http")
+		}
+		cs.WriteData("logaddress_add_http \"%s\"", cs.GetHTTPLogURL())
+		cs.WriteData("log on")
+		return
+	}
+
+	if changed {
+		cs.WriteData("logaddress_del %s", previous)
+	}
+	cs.WriteData("sv_logsecret %s", cs.logSecret)
+	cs.WriteData("logaddress_add %s", address)
 	cs.WriteData("log on")
 }
 
-func (cs *CS) WriteData(data string, v ...interface{}) (){
-	buffer := fmt.Sprintf(data, v...)
-	_, err := cs.rc.writeCmd(SERVERDATA_EXECCOMMAND, buffer)
+var sayReplacer = strings.NewReplacer(";", "", "\"", "", "\r", "", "\n", " ")
 
-	if err != nil {
-		log.Println(err)
-		cs.rc.Close()
-		for {
-			success := cs.ConnectToRcon()
-			if !success {
-				log.Printf("Unable to reconnect to RCON: %s. Trying again in 1 second.\n", cs.serverIP)
-				time.Sleep(time.Second * 1)
-			} else {
-				log.Printf("Restablished connection to server RCON %s.\n", cs.serverIP)
-				cs.WriteData(data, v)
-				return
-			}
-		}
-	}
-	log.Printf("Sent(RCON): %s\n", buffer)
+// Say shows a message in-game. Quotes, semicolons and newlines are removed as a player name or chat
+// message containing them could otherwise run its own console commands.
+func (cs *CS) Say(data string, v ...interface{}) {
+	cs.WriteData("say %s", sayReplacer.Replace(fmt.Sprintf(data, v...)))
+}
+
+// WriteData queues an RCON command for the server, it never blocks when the server is down.
+func (cs *CS) WriteData(data string, v ...interface{}) (){
+	cs.rcon.Send(fmt.Sprintf(data, v...))
 }
 
+// ConnectToRcon opens a new authenticated RCON connection and hands it to the server's session.
 func (cs *CS) ConnectToRcon() bool  {
 	const timeout = 10 * time.Second
-	err := errors.New("")
-	cs.rc.conn, err = net.Dial("tcp", cs.serverIP)
+	rc := &RemoteConsole{}
+	var err error
+	rc.conn, err = net.DialTimeout("tcp", cs.serverIP, timeout)
 	
 	if err != nil {
 		log.Printf("Unable to connect to server RCON at %s", cs.serverIP)
 		return false
 	}
 
-	cs.rc.reqid = 0x7fffffff
+	rc.reqid = 0x7fffffff
 	var reqid int
-	reqid, err = cs.rc.writeCmd(SERVERDATA_AUTH, cs.rconPassword)
+	reqid, err = rc.writeCmd(SERVERDATA_AUTH, cs.rconPassword)
 	
 	if err != nil {
 		log.Printf("Error authenticating: %s\n", err)
+		rc.Close()
 		return false
 	}
 
-	cs.rc.readbuf = make([]byte, readBufferSize)
+	rc.readbuf = make([]byte, readBufferSize)
 
 	var respType, requestId int
-	respType, requestId, _, err = cs.rc.readResponse(timeout)
+	respType, requestId, _, err = rc.readResponse(timeout)
 	if err != nil {
 		log.Printf("Error reading response: %s\n", err)
+		rc.Close()
 		return false
 	}
 
 	if respType != SERVERDATA_AUTH_RESPONSE {
-		respType, requestId, _, err = cs.rc.readResponse(timeout)
+		respType, requestId, _, err = rc.readResponse(timeout)
 	}
 
 	if err != nil {
 		log.Printf("Error: %s", err)
+		rc.Close()
 		return false
 	}
 
 	if respType != SERVERDATA_AUTH_RESPONSE {
 		log.Println(ErrInvalidAuthResponse)
+		rc.Close()
 		return false
 	}
 	if requestId != reqid {
 		log.Println(ErrAuthFailed)
+		rc.Close()
 		return false
 	}
 
-	cs.localIP = strings.Split(cs.rc.conn.LocalAddr().String(), ":")[0]
-	log.Printf("Internal IP: %s\n", cs.localIP)
+	if len(cs.localIP) == 0 {
+		cs.localIP = strings.Split(rc.conn.LocalAddr().String(), ":")[0]
+		log.Printf("Internal IP: %s\n", cs.localIP)
+	}
+	cs.rcon.SetConsole(rc)
 	return true
 }
 
-func (cs *CS) RecvData() {
+// RecvData reads log packets from a UDP listener and handles them on the owner goroutine. The
+// shared listener has no server, its packets are routed with GetServerByLogPacket.
+func RecvData(socket *net.UDPConn, cs *CS) {
+	buffer := make([]byte, maxLogPacketSize)
 	for {
-		buffer := make([]byte, 1024)
-		rlen, _, err := cs.SrvSocket.ReadFromUDP(buffer)
+		rlen, addr, err := socket.ReadFromUDP(buffer)
 
 		if err != nil {
 			log.Printf("Unable to read data from UDP socket. Error: %s\n", err)
 			break;
 		}
 
-		s := string(buffer)
-		s = s[5:rlen-2]
-		log.Printf("Received %d bytes: (%s)\n", rlen, s)
-		cs.HandleCSBuffer(strings.Split(s, " "))
+		packet := append([]byte{}, buffer[:rlen]...)
+		Do(func() {
+			target := cs
+			if target == nil {
+				var success bool
+				if target, success = GetServerByLogPacket(addr, packet); !success {
+					log.Printf("Dropped a log packet from %s, it doesn't belong to any server.\n", addr)
+					return
+				}
+			}
+			target.HandleLogPacket(addr, packet)
+		})
 	}
 }
 
+func (cs *CS) HandleLogPacket(addr *net.UDPAddr, packet []byte) {
+	if !cs.IsLogSender(addr.IP) {
+		log.Printf("Dropped a log packet from %s, server %s logs from %s\n", addr, cs.serverIP, cs.serverAddr.IP)
+		return
+	}
+
+	lines, err := cs.ReadLogPacket(packet)
+	if err != nil {
+		log.Printf("Dropped a log packet from %s. Error: %s\n", addr, err)
+		return
+	}
+
+	for _, line := range lines {
+		cs.HandleLogLine(line)
+	}
+}
+
+// HandleLogLine handles a log line in the "L date - time: message" form. A line the handlers
+// can't cope with is logged and skipped rather than taking down the owner goroutine.
+func (cs *CS) HandleLogLine(s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Unable to handle log line from server %s: (%s). Error: %v\n", cs.serverIP, s, r)
+		}
+	}()
+
+	log.Printf("Received %d bytes: (%s)\n", len(s), s)
+	cs.SetLogReceived()
+	cs.HandleCSBuffer(strings.Split(s, " "))
+}
+
 func GetPlayerInfo(playerInfo string) (string, string, string, string) {
 	if strings.Count(playerInfo, "<") == 0 {
 		return "", "", "", ""
@@ -269,6 +437,210 @@ func GetPlayerInfo(playerInfo string) (string, string, string, string) {
 	return player, playerID, steamID, team
 }
 
+func (cs *CS) GetPermissionLevel(steamID string) (int) {
+	if (len(cs.authSteamID) > 0 && cs.authSteamID == steamID) {
+		return PERMISSION_ADMIN
+	}
+
+	pug, success := GetPugByID(cs.pugID)
+	if !success {
+		return PERMISSION_PLAYER
+	}
+
+	player, linked := pug.GetPlayerBySteamID(steamID)
+	if linked && pug.IsCaptain(player) {
+		return PERMISSION_CAPTAIN
+	}
+	return PERMISSION_PLAYER
+}
+
+func (cs *CS) SendPlayerStats(steamID, username string) {
+	player, success := cs.sm.GetPlayerStats(steamID, username)
+	if !success {
+		cs.Say("No stats have been recorded for %s yet.", username)
+		return
+	}
+
+	cs.Say("Stats for %s: %d kills, %d deaths, %d bombs planted, %d bombs defused.", username, player.kills, player.deaths, player.bombPlanted, player.bombDefused)
+}
+
+func (cs *CS) EndMatch() {
+	mapName := ""
+	pug, success := GetPugByID(cs.pugID)
+	if success {
+		mapName = pug.GetMap()
+		pug.EndPug()
+		DeletePug(pug.GetPugID())
+	}
+	cs.sm.AddEventStatsAll(MATCH_FINISHED)
+	cs.sm.SaveMatchData(mapName)
+	cs.RelayGameEvents = false
+	pugID := cs.pugID
+	After(time.Second * 5, func() {
+		// the server may have been freed and given to another PUG in the meantime
+		if cs.pugID != pugID || !cs.InUse {
+			return
+		}
+
+		cs.WriteData("_restart") // kick all clients and set pw to a temp one
+		cs.SendToChannel("The PUG has completed, type %s <map> to start a new one!", Cmd("pug"))
+		cs.WriteData("sv_password %s", pug.GenerateRandomPassword("temp"))
+		cs.ReleaseServer()
+	})
+}
+
+// ReleaseServer clears any match state and returns the server to the pool of free servers.
+func (cs *CS) ReleaseServer() {
+	cs.sm.Reset()
+	cs.pm.Reset()
+	cs.SetInUseStatus(false)
+	cs.SetIRCChannel("")
+	cs.SetPugID(0)
+	cs.authSteamID = ""
+	cs.RelayGameEvents = false
+	cs.teams = nil
+}
+
+// ResetPugAdmin revokes the in-game rights of the previous PUG admin and sets a new admin password,
+// so only the new admin can log in.
+func (cs *CS) ResetPugAdmin(pug *PUG) {
+	cs.authSteamID = ""
+	cs.pugAdminPassword = pug.GenerateRandomPassword("admin")
+}
+
+func (cs *CS) VoteForfeit(player, steamID, team string) {
+	if team != "CT" && team != "TERRORIST" {
+		cs.Say("Only players on a team can vote to forfeit.")
+		return
+	}
+
+	if !cs.sm.AddForfeitVote(steamID, team) {
+		return
+	}
+
+	// a majority of the team, which is at least the smaller half of the PUG in case some players
+	// haven't appeared in the logs yet
+	teamSize := cs.GetTeamSize(team)
+	if pug, success := GetPugByID(cs.pugID); success && pug.GetPlayerCount() / 2 > teamSize {
+		teamSize = pug.GetPlayerCount() / 2
+	}
+
+	votes := cs.sm.GetForfeitVotes(team)
+	needed := teamSize / 2 + 1
+	if votes < needed {
+		cs.Say("%s voted to forfeit the match for the %s [%d/%d]. Type %s to agree.", player, GetTeamDisplayName(team), votes, needed, Cmd("gg"))
+		cs.SendToChannel("*** %s voted to forfeit the match for the %s [%d/%d].", player, GetTeamDisplayName(team), votes, needed)
+		return
+	}
+
+	winner := "CT"
+	if team == "CT" {
+		winner = "TERRORIST"
+	}
+
+	cs.sm.SetForfeitTeam(team)
+	cs.sm.SetMatchCompleted(true)
+	cs.SendToChannel("MATCH FORFEITED. The %s have surrendered, the %s win.", GetTeamDisplayName(team), GetTeamDisplayName(winner))
+	cs.Say("MATCH FORFEITED. The %s have surrendered, the %s win.", GetTeamDisplayName(team), GetTeamDisplayName(winner))
+	cs.EndMatch()
+}
+
+// UpdatePlayerTeam records the side of the player a log line is about.
+func (cs *CS) UpdatePlayerTeam(csBuffer []string) {
+	if strings.Count(csBuffer[4], "<") < 3 {
+		return
+	}
+
+	_,_,steamID,team := GetPlayerInfo(csBuffer[4])
+	if steamID == "BOT" || steamID == "Console" {
+		return
+	}
+
+	if csBuffer[5] == "switched" {
+		team = strings.Trim(csBuffer[len(csBuffer)-1], "<>")
+	}
+
+	if cs.teams == nil {
+		cs.teams = make(map[string]string)
+	}
+
+	if csBuffer[5] == "disconnected" || (team != "CT" && team != "TERRORIST") {
+		delete(cs.teams, steamID)
+		return
+	}
+	cs.teams[steamID] = team
+}
+
+func (cs *CS) GetTeamSize(team string) (int) {
+	size := 0
+	for steamID := range cs.teams {
+		if cs.teams[steamID] == team {
+			size++
+		}
+	}
+	return size
+}
+
+func GetTeamDisplayName(team string) (string) {
+	if team == "CT" {
+		return "Counter-Terrorists"
+	}
+	return "Terrorists"
+}
+
+func (cs *CS) GoLive() {
+	if (!cs.RelayGameEvents) {
+		cs.RelayGameEvents = true
+		log.Println("Game event relaying enabled.")
+	}
+	cs.WriteData("mp_maxrounds 30")
+	cs.Say("Going Live on 1 restart..")
+	cs.WriteData("mp_warmup_end")
+	cs.WriteData("mp_restartgame 1")
+	cs.Say("LIVE! LIVE! LIVE! Good luck and have fun")
+	cs.SendToChannel("*** MATCH HAS GONE LIVE.")
+}
+
+func (cs *CS) StartKnifeRound() {
+	cs.sm.SetKnifeRoundStarted(true)
+	cs.WriteData("mp_ct_default_secondary \"\"")
+	cs.WriteData("mp_t_default_secondary \"\"")
+	cs.WriteData("mp_give_player_c4 0")
+	cs.WriteData("mp_free_armor 1")
+	cs.WriteData("mp_startmoney 0")
+	cs.WriteData("mp_maxrounds 999")
+	cs.Say("Knife round on 1 restart..")
+	cs.WriteData("mp_warmup_end")
+	cs.WriteData("mp_restartgame 1")
+	cs.Say("KNIFE! KNIFE! KNIFE! The winners choose their side.")
+	cs.SendToChannel("*** KNIFE ROUND HAS STARTED.")
+}
+
+func (cs *CS) ChooseSide(player string, switchSides bool) {
+	winner := cs.sm.GetKnifeWinner()
+	cs.sm.SetKnifeWinner("")
+
+	cs.WriteData("mp_ct_default_secondary weapon_hkp2000")
+	cs.WriteData("mp_t_default_secondary weapon_glock")
+	cs.WriteData("mp_give_player_c4 1")
+	cs.WriteData("mp_free_armor 0")
+	cs.WriteData("mp_startmoney 800")
+	cs.WriteData("mp_unpause_match")
+
+	if switchSides {
+		cs.Say("%s chose to switch sides.", player)
+		cs.SendToChannel("*** %s chose to switch sides, the %s are swapping teams.", player, GetTeamDisplayName(winner))
+		cs.WriteData("mp_swapteams")
+	} else {
+		cs.Say("%s chose to stay.", player)
+		cs.SendToChannel("*** %s chose to stay, the %s keep their side.", player, GetTeamDisplayName(winner))
+	}
+
+	cs.sm.ResetRoundCounter()
+	cs.sm.SetFirstHalfStarted(true)
+	cs.GoLive()
+}
+
 func (cs *CS) HandleCSBuffer(csBuffer []string) {
 	if (cs.DumpProtocolMessages) {
 		log.Printf("csBuffer size: %d\n", len(csBuffer))
@@ -280,14 +652,15 @@ func (cs *CS) HandleCSBuffer(csBuffer []string) {
 	if len(csBuffer) <= 5 {
 		return
 	}
+	cs.UpdatePlayerTeam(csBuffer)
 
 	if (csBuffer[5] == "entered" && cs.InUse) {
 		player,_,steamID,_ := GetPlayerInfo(csBuffer[4])
-		irc.SendToChannel(cs.ircChannel, "%s (%s) has entered the game.", player, steamID)
+		cs.SendToChannel("%s (%s) has entered the game.", player, steamID)
 		cs.sm.AddPlayer(steamID, player)
 	} else if (csBuffer[5] == "disconnected" && cs.InUse) {
 		player,_,steamID,_ := GetPlayerInfo(csBuffer[4])
-		irc.SendToChannel(cs.ircChannel, "%s (%s) has left the game.", player, steamID)
+		cs.SendToChannel("%s (%s) has left the game.", player, steamID)
 		cs.sm.RemovePlayer(steamID, player)
 	} else if csBuffer[5] == "triggered" && cs.RelayGameEvents {
 		player,_,steamID,_ := GetPlayerInfo(csBuffer[4])
@@ -295,22 +668,22 @@ func (cs *CS) HandleCSBuffer(csBuffer []string) {
 
 		switch event {
 			case "Begin_Bomb_Defuse_Without_Kit": 
-				irc.SendToChannel(cs.ircChannel, "%s started bomb defuse without kit.", player)
+				cs.SendToChannel("%s started bomb defuse without kit.", player)
 				cs.sm.AddEventStats(BOMB_DEFUSE_ATTEMPTED_WITHOUT_KIT, steamID, player)
 			case "Begin_Bomb_Defuse_With_Kit":
-				irc.SendToChannel(cs.ircChannel, "%s started bomb defuse with kit.", player)
+				cs.SendToChannel("%s started bomb defuse with kit.", player)
 				cs.sm.AddEventStats(BOMB_DEFUSE_ATTEMPTED_WITH_KIT, steamID, player)
 			case "Dropped_The_Bomb":
-				irc.SendToChannel(cs.ircChannel, "%s dropped the bomb.", player)
+				cs.SendToChannel("%s dropped the bomb.", player)
 				cs.sm.AddEventStats(BOMB_DROPPED, steamID, player)
 			case "Planted_The_Bomb": 
-				irc.SendToChannel(cs.ircChannel, "%s planted the bomb.", player)
+				cs.SendToChannel("%s planted the bomb.", player)
 				cs.sm.AddEventStats(BOMB_PLANTED, steamID, player)
 			case "Got_The_Bomb":
-				irc.SendToChannel(cs.ircChannel, "%s picked up the bomb.", player)
+				cs.SendToChannel("%s picked up the bomb.", player)
 				cs.sm.AddEventStats(BOMB_PICKED_UP, steamID, player)
 			case "Defused_The_Bomb":
-				irc.SendToChannel(cs.ircChannel, "%s defused the bomb.", player)
+				cs.SendToChannel("%s defused the bomb.", player)
 				cs.sm.AddEventStats(BOMB_DEFUSED, steamID, player)
 			case "Round_Start":
 				cs.sm.ResetRoundPlayersLeft()
@@ -319,42 +692,64 @@ func (cs *CS) HandleCSBuffer(csBuffer []string) {
 				cs.sm.AddEventStatsAll(ROUND_FINISHED)
 				if cs.sm.SecondHalfStarted() {
 					cs.WriteData("say			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore() + cs.sm.GetFirstHalfT(), cs.sm.GetTScore() + cs.sm.GetFirstHalfCT())
-					irc.SendToChannel(cs.ircChannel, "			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore() + cs.sm.GetFirstHalfT(), cs.sm.GetTScore() + cs.sm.GetFirstHalfCT())
+					cs.SendToChannel("			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore() + cs.sm.GetFirstHalfT(), cs.sm.GetTScore() + cs.sm.GetFirstHalfCT())
 				} else {
 					cs.WriteData("say			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore(), cs.sm.GetTScore())
-					irc.SendToChannel(cs.ircChannel, "			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore(), cs.sm.GetTScore())
+					cs.SendToChannel("			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore(), cs.sm.GetTScore())
 				}
-				irc.SendToChannel(cs.ircChannel, "******************** ROUND ENDED ********************")
-				irc.SendToChannel(cs.ircChannel, "******************** ROUND STARTED ******************")
+				cs.SendToChannel("******************** ROUND ENDED ********************")
+				cs.SendToChannel("******************** ROUND STARTED ******************")
 		}
 		return;
+	} else if len(csBuffer) > 7 && csBuffer[6] == "triggered" && cs.sm.KnifeRoundStarted() {
+		event := csBuffer[7][1:len(csBuffer[7])-1];
+		winner := ""
+
+		switch event {
+			case "SFUI_Notice_Target_Bombed", "SFUI_Notice_Terrorists_Win":
+				winner = "TERRORIST"
+			case "SFUI_Notice_Bomb_Defused", "SFUI_Notice_CTs_Win", "SFUI_Notice_Target_Saved":
+				winner = "CT"
+		}
+
+		if len(winner) == 0 {
+			return
+		}
+
+		cs.sm.SetKnifeRoundStarted(false)
+		cs.sm.SetKnifeWinner(winner)
+		cs.WriteData("mp_pause_match")
+		cs.Say("The %s won the knife round! Type %s or %s to choose your side.", GetTeamDisplayName(winner), Cmd("stay"), Cmd("switch"))
+		cs.SendToChannel("*** The %s won the knife round and are choosing sides.", GetTeamDisplayName(winner))
+		return
 	} else if csBuffer[6] == "triggered" && cs.RelayGameEvents {
 		event := csBuffer[7][1:len(csBuffer[7])-1];
 
 		switch event {
 			case "SFUI_Notice_Target_Bombed":
 				cs.sm.SetTScore(cs.sm.GetTScore()+1)
-				irc.SendToChannel(cs.ircChannel, "*** Target bombed successfully, the Terrorists win! ***")
+				cs.SendToChannel("*** Target bombed successfully, the Terrorists win! ***")
 			case "SFUI_Notice_Terrorists_Win":
 				cs.sm.SetTScore(cs.sm.GetTScore()+1)
-				irc.SendToChannel(cs.ircChannel, "******* All CT's eliminated, the Terrorists win! *******")
+				cs.SendToChannel("******* All CT's eliminated, the Terrorists win! *******")
 			case "SFUI_Notice_Bomb_Defused":
 				cs.sm.SetCTScore(cs.sm.GetCTScore()+1)
-				irc.SendToChannel(cs.ircChannel, "******* Bomb defused, the Counter-Terrorists win! ******")
+				cs.SendToChannel("******* Bomb defused, the Counter-Terrorists win! ******")
 			case "SFUI_Notice_CTs_Win":
 				cs.sm.SetCTScore(cs.sm.GetCTScore()+1)
-				irc.SendToChannel(cs.ircChannel, "*** All Terrorists eliminated, the Counter-Terrorists win! ***\n")
+				cs.SendToChannel("*** All Terrorists eliminated, the Counter-Terrorists win! ***\n")
 		}
 
 		if cs.sm.FirstHalfStarted() {
 			if cs.sm.GetCTScore() + cs.sm.GetTScore() == 15 {
-				irc.SendToChannel(cs.ircChannel, "			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore(), cs.sm.GetTScore())
-				irc.SendToChannel(cs.ircChannel, "*** The first half has been completed.")
-				cs.WriteData("say The first half has been completed! Type !lo3 to commence second half.")
+				cs.SendToChannel("			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore(), cs.sm.GetTScore())
+				cs.SendToChannel("*** The first half has been completed.")
+				cs.Say("The first half has been completed! Type %s to commence second half.", Cmd("lo3"))
 				cs.WriteData("say			CT Score (%d)  			T Score (%d)		", cs.sm.GetCTScore(), cs.sm.GetTScore())
 				cs.WriteData("mp_maxrounds 999")
 				cs.sm.PreservePlayerStatsFirstHalf()
 				cs.sm.ResetPlayerStats()
+				cs.sm.ResetForfeitVotes()
 				cs.sm.SetFirstHalfT(cs.sm.GetTScore())
 				cs.sm.SetFirstHalfCT(cs.sm.GetCTScore())
 				cs.sm.SetTScore(0)
@@ -364,139 +759,33 @@ func (cs *CS) HandleCSBuffer(csBuffer []string) {
 		}
 		if cs.sm.SecondHalfStarted() {
 			if cs.sm.GetCTScore() + cs.sm.GetFirstHalfT() == 16 {
-				irc.SendToChannel(cs.ircChannel, "MATCH COMPLETED SUCCESSFULLY. The score was %d - %d", cs.sm.GetCTScore() + cs.sm.GetFirstHalfT(), cs.sm.GetTScore() + cs.sm.GetFirstHalfCT())
-				cs.WriteData("say MATCH COMPLETED SUCCESSFULLY. The Score was %d - %d", cs.sm.GetCTScore() + cs.sm.GetFirstHalfT(), cs.sm.GetTScore() + cs.sm.GetFirstHalfCT())
+				cs.SendToChannel("MATCH COMPLETED SUCCESSFULLY. The score was %d - %d", cs.sm.GetCTScore() + cs.sm.GetFirstHalfT(), cs.sm.GetTScore() + cs.sm.GetFirstHalfCT())
+				cs.Say("MATCH COMPLETED SUCCESSFULLY. The Score was %d - %d", cs.sm.GetCTScore() + cs.sm.GetFirstHalfT(), cs.sm.GetTScore() + cs.sm.GetFirstHalfCT())
 				cs.sm.SetMatchCompleted(true)
 			} else if cs.sm.GetCTScore() + cs.sm.GetFirstHalfT() == 15 {
-				irc.SendToChannel(cs.ircChannel, "MATCH COMPLETED SUCCESSFULLY. The match was a draw.")
-				cs.WriteData("say MATCH COMPLETED SUCCESSFULLY. The match was a draw.")
+				cs.SendToChannel("MATCH COMPLETED SUCCESSFULLY. The match was a draw.")
+				cs.Say("MATCH COMPLETED SUCCESSFULLY. The match was a draw.")
 				cs.sm.SetMatchCompleted(true)
 			} else if cs.sm.GetTScore() + cs.sm.GetFirstHalfCT()  == 16 {
-				irc.SendToChannel(cs.ircChannel, "MATCH COMPLETED SUCCESSFULLY. The score was %d - %d", cs.sm.GetTScore() + cs.sm.GetFirstHalfCT(), cs.sm.GetCTScore() + cs.sm.GetFirstHalfT())
-				cs.WriteData("say MATCH COMPLETED SUCCESSFULLY. The Score was %d - %d", cs.sm.GetTScore() + cs.sm.GetFirstHalfCT(), cs.sm.GetCTScore() + cs.sm.GetFirstHalfT())
+				cs.SendToChannel("MATCH COMPLETED SUCCESSFULLY. The score was %d - %d", cs.sm.GetTScore() + cs.sm.GetFirstHalfCT(), cs.sm.GetCTScore() + cs.sm.GetFirstHalfT())
+				cs.Say("MATCH COMPLETED SUCCESSFULLY. The Score was %d - %d", cs.sm.GetTScore() + cs.sm.GetFirstHalfCT(), cs.sm.GetCTScore() + cs.sm.GetFirstHalfT())
 				cs.sm.SetMatchCompleted(true)
 			}
 
 			if cs.sm.MatchCompleted() {
-				pug, _ := GetPugByChannel(cs.ircChannel)
-				pug.EndPug()
-				DeletePug(pug.GetPugID())
-				cs.sm.AddEventStatsAll(MATCH_FINISHED)
-				cs.sm.SaveMatchData()
-				cs.sm.Reset()
-				time.Sleep(time.Second * 5)
-				cs.WriteData("_restart") // kick all clients and set pw to a temp one
-				irc.SendToChannel(cs.ircChannel, "The PUG has completed, type !pug <map> to start a new one!")
-				cs.WriteData("sv_password %s", pug.GenerateRandomPassword("temp"))
-				cs.SetInUseStatus(false)	
-				cs.SetIRCChannel("")
+				cs.EndMatch()
 			}
 		}
 	} else if (csBuffer[5] == "say") {
-		player,_,steamID,_ := GetPlayerInfo(csBuffer[4])
+		player,_,steamID,team := GetPlayerInfo(csBuffer[4])
 		log.Printf("Player %s said %s\n", player, strings.Join(csBuffer[6:], " "))
 		message := strings.Join(csBuffer[6:], " ")
 		message = message[1:len(message)-1]
 		msg := strings.Split(message, " ")
 
-		if (len(cs.authSteamID) == 0) {
-			if (msg[0] == "!login" && len(msg) > 1) {
-				password := msg[1];
-				log.Printf("IN-GAME AUTH request: comparing '%s' to '%s'\n", password, cs.pugAdminPassword)
-				if (password == cs.pugAdminPassword) {
-					cs.WriteData("say PUG admin rights has been granted to %s", player)
-					irc.SendToChannel(cs.ircChannel, "PUG admin rights has been granted to %s", player)
-					cs.authSteamID = steamID
-					return;
-				}
-			} else {
-				// bot doesn't allow any unauthenticated message handling
-				return
-			}
-		} else {
-			if (cs.authSteamID != steamID) {
-				log.Println("Invalid auth attempt.")
-				return
-			}
-		}
-		if (msg[0] == "!lo3") {
-			if !cs.sm.FirstHalfStarted() && !cs.sm.SecondHalfStarted() {
-				cs.sm.ResetRoundCounter()
-				cs.sm.SetFirstHalfStarted(true)
-			} else if cs.sm.FirstHalfStarted() && cs.sm.GetFirstHalfT() + cs.sm.GetFirstHalfCT() < 15 {
-				cs.WriteData("say First half has already commenced. If you wish to cancel the first half, please type !cancelhalf.")
-				return;
-			} else if cs.sm.FirstHalfStarted() && cs.sm.GetFirstHalfT() + cs.sm.GetFirstHalfCT() == 15 {
-				cs.sm.SetSecondHalfStarted(true)
-				cs.WriteData("say The second half has begun!")
-				irc.SendToChannel(cs.ircChannel, "The second half has begun!")
-			}
-			if (!cs.RelayGameEvents) {
-				cs.RelayGameEvents = true
-				log.Println("Game event relaying enabled.")
-			}
-			cs.WriteData("mp_maxrounds 30")
-			cs.WriteData("say Going Live on 1 restart..")
-			cs.WriteData("mp_warmup_end")
-			cs.WriteData("mp_restartgame 1")
-			cs.WriteData("say LIVE! LIVE! LIVE! Good luck and have fun")
-			irc.SendToChannel(cs.ircChannel, "*** MATCH HAS GONE LIVE.")
-			return;
-		} else if (msg[0] == "!request") {
-			cs.WriteData("say Requesting for players on IRC.")
-			irc.SendToChannel(cs.ircChannel, "Need player! To join, use the connect string: connect %s; password %s", cs.serverIP, cs.serverPassword)
-			return;
-		} else if (msg[0] == "!restart") {
-			if cs.sm.FirstHalfStarted() || cs.sm.SecondHalfStarted() {
-				cs.WriteData("say You are unable to restart the round once the game has gone live.")
-				return
-			}
-			cs.WriteData("mp_restartgame 1")
-			return;
-		} else if (msg[0] == "!cancelhalf") {
-			if cs.sm.FirstHalfStarted() && !cs.sm.SecondHalfStarted() {
-				cs.sm.ResetRoundCounter()
-				cs.sm.SetFirstHalfStarted(false)
-				cs.sm.ResetPlayerStats()
-				cs.RelayGameEvents = false
-				cs.WriteData("mp_maxrounds 999")
-				cs.WriteData("say First half has been cancelled. Please type !lo3 once all players are ready.")
-				irc.SendToChannel(cs.ircChannel, "*** First half has been cancelled.")
-				return
-			} else if cs.sm.FirstHalfStarted() && cs.sm.SecondHalfStarted() {
-				cs.sm.ResetRoundCounter();
-				cs.sm.SetSecondHalfStarted(false)
-				cs.sm.ResetPlayerStats()
-				cs.RelayGameEvents = false
-				cs.WriteData("mp_maxrounds 999")
-				cs.WriteData("say Second half has been cancelled. Please type !lo3 once all players are ready.")
-				irc.SendToChannel(cs.ircChannel, "*** Second half has been cancelled.")
-				return
-			}
-		} else if (msg[0] == "!map" && len(msg) > 1) {
-			if cs.sm.FirstHalfStarted() || cs.sm.SecondHalfStarted() {
-				cs.WriteData("say You are unable to change the map once the game has gone live.")
-				return
-			}
-
-			mapName := msg[1];
-			if !IsValidMap(mapName) {
-				cs.WriteData("Invalid map selection. Please select a map from the following: %s ", GetValidMaps())
-				return
-			}
-
-			cs.WriteData("say Changing map to '%s'.", mapName)
-			cs.WriteData("changelevel %s", mapName)
-			irc.SendToChannel(cs.ircChannel, "PUG admin changed level to %s", mapName)
-			return;
-		} else if (msg[0] == "!irc") {
-			if (len(msg) > 1) {
-				s := strings.Join(msg[1:], " ")
-				cs.WriteData("say Sending message to IRC: %s.", s)
-				irc.SendToChannel(cs.ircChannel, "[CS]: %s", s)
-				return;
-			}
-		}
+		ctx := &CommandContext{Source: SOURCE_GAME, Channel: cs.ircChannel, Nickname: player, SteamID: steamID, Team: team, CS: cs, Level: cs.GetPermissionLevel(steamID)}
+		DispatchCommand(ctx, msg)
+		return
 	}
 	if len(csBuffer) >= 14 && cs.RelayGameEvents {
 		if (csBuffer[8] == "killed") {
@@ -513,16 +802,16 @@ func (cs *CS) HandleCSBuffer(csBuffer []string) {
 
 			if team1 == "TERRORIST" && team2 == "CT" {
 				cs.sm.SetCTsLeft(cs.sm.GetCTsLeft()-1)
-				irc.SendToChannel(cs.ircChannel, "%s (T) killed %s (CT) with %s %s [%d/5 left]\n", player1, player2, weapon, headshot, cs.sm.GetCTsLeft())
+				cs.SendToChannel("%s (T) killed %s (CT) with %s %s [%d/5 left]\n", player1, player2, weapon, headshot, cs.sm.GetCTsLeft())
 			} else if team1 == "CT" && team2 == "TERRORIST" {
 				cs.sm.SetTsLeft(cs.sm.GetTsLeft()-1)
-				irc.SendToChannel(cs.ircChannel, "%s (CT) killed %s (T) with %s %s [%d/5 left]\n", player1, player2, weapon, headshot, cs.sm.GetTsLeft())	
+				cs.SendToChannel("%s (CT) killed %s (T) with %s %s [%d/5 left]\n", player1, player2, weapon, headshot, cs.sm.GetTsLeft())	
 			} else if team1 == "TERRORIST" && team2 == "TERRORIST" {
 				cs.sm.SetTsLeft(cs.sm.GetTsLeft()-1)
-				irc.SendToChannel(cs.ircChannel, "%s (T) killed %s (T) with %s %s [%d/5 left]\n", player1, player2, weapon, headshot, cs.sm.GetTsLeft())	
+				cs.SendToChannel("%s (T) killed %s (T) with %s %s [%d/5 left]\n", player1, player2, weapon, headshot, cs.sm.GetTsLeft())	
 			} else if team1 == "CT" && team2 == "CT" {
 				cs.sm.SetCTsLeft(cs.sm.GetCTsLeft()-1)
-				irc.SendToChannel(cs.ircChannel, "%s (CT) killed %s (CT) with %s %s [%d/5 left]\n", player1, player2, weapon, headshot, cs.sm.GetCTsLeft())	
+				cs.SendToChannel("%s (CT) killed %s (CT) with %s %s [%d/5 left]\n", player1, player2, weapon, headshot, cs.sm.GetCTsLeft())	
 			}
 		}
 	}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+func RegisterGameCommands() {
+	RegisterCommand(&Command{Name: "login", Usage: "<password>", MinArgs: 1, Source: SOURCE_GAME, Help: "Grants PUG admin rights with the password messaged to the PUG admin.", Handler: cmdLogin})
+	RegisterCommand(&Command{Name: "stats", Source: SOURCE_GAME, Help: "Shows your stats for the match.", Handler: cmdGameStats})
+	RegisterCommand(&Command{Name: "stay", Source: SOURCE_GAME, Help: "Keeps the current sides after winning the knife round.", Handler: cmdChooseSide})
+	RegisterCommand(&Command{Name: "switch", Source: SOURCE_GAME, Help: "Switches sides after winning the knife round.", Handler: cmdChooseSide})
+	RegisterCommand(&Command{Name: "gg", Aliases: []string{"forfeit"}, Source: SOURCE_GAME, Help: "Votes for your team to forfeit the match.", Handler: cmdForfeit})
+	RegisterCommand(&Command{Name: "pause", Source: SOURCE_GAME, Help: "Calls a technical pause at the end of the round.", Handler: cmdPause})
+	RegisterCommand(&Command{Name: "timeout", Source: SOURCE_GAME, Help: "Calls a tactical timeout for your team.", Handler: cmdPause})
+	RegisterCommand(&Command{Name: "unpause", Aliases: []string{"ready"}, Source: SOURCE_GAME, Help: "Marks your team as ready to unpause the match.", Handler: cmdPause})
+	RegisterCommand(&Command{Name: "lo3", Usage: "[force]", Permission: PERMISSION_ADMIN, Source: SOURCE_GAME, Help: "Starts the next half live on 3 once every player is connected, force skips the check.", Handler: cmdLo3})
+	RegisterCommand(&Command{Name: "knife", Permission: PERMISSION_ADMIN, Source: SOURCE_GAME, Help: "Starts a knife round to decide sides.", Handler: cmdKnife})
+	RegisterCommand(&Command{Name: "request", Permission: PERMISSION_ADMIN, Source: SOURCE_GAME, Help: "Asks for another player on IRC.", Handler: cmdRequest})
+	RegisterCommand(&Command{Name: "restart", Permission: PERMISSION_ADMIN, Source: SOURCE_GAME, Help: "Restarts the game before it goes live.", Handler: cmdRestart})
+	RegisterCommand(&Command{Name: "cancelhalf", Permission: PERMISSION_ADMIN, Source: SOURCE_GAME, Help: "Cancels the half being played.", Handler: cmdCancelHalf})
+	RegisterCommand(&Command{Name: "map", Usage: "<map>", MinArgs: 1, Permission: PERMISSION_ADMIN, Source: SOURCE_GAME, Help: "Changes the map before the game goes live.", Handler: cmdMap})
+	RegisterCommand(&Command{Name: "irc", Usage: "<message>", MinArgs: 1, Permission: PERMISSION_ADMIN, Source: SOURCE_GAME, Help: "Sends a message to the PUG channel.", Handler: cmdIRC})
+}
+
+func cmdLogin(ctx *CommandContext) {
+	cs := ctx.CS
+	if len(cs.authSteamID) > 0 {
+		return
+	}
+	log.Printf("IN-GAME AUTH request: comparing '%s' to '%s'\n", ctx.Args[0], cs.pugAdminPassword)
+	if ctx.Args[0] == cs.pugAdminPassword {
+		ctx.Reply("PUG admin rights has been granted to %s", ctx.Nickname)
+		cs.SendToChannel("PUG admin rights has been granted to %s", ctx.Nickname)
+		cs.authSteamID = ctx.SteamID
+	}
+}
+
+func cmdGameStats(ctx *CommandContext) {
+	ctx.CS.SendPlayerStats(ctx.SteamID, ctx.Nickname)
+}
+
+func cmdChooseSide(ctx *CommandContext) {
+	cs := ctx.CS
+	if len(cs.sm.GetKnifeWinner()) == 0 {
+		return
+	}
+	if ctx.Level < PERMISSION_ADMIN && ctx.Team != cs.sm.GetKnifeWinner() {
+		ctx.Reply("Only the team that won the knife round can choose sides.")
+		return
+	}
+	pug, success := GetPugByID(cs.pugID)
+	if ctx.Level < PERMISSION_CAPTAIN && success && pug.CaptainsLinked() {
+		ctx.Reply("Only the team captain can choose sides.")
+		return
+	}
+	cs.ChooseSide(ctx.Nickname, ctx.Command.Name == "switch")
+}
+
+func cmdForfeit(ctx *CommandContext) {
+	cs := ctx.CS
+	if !cs.sm.FirstHalfStarted() && !cs.sm.SecondHalfStarted() {
+		return
+	}
+	cs.VoteForfeit(ctx.Nickname, ctx.SteamID, ctx.Team)
+}
+
+func cmdPause(ctx *CommandContext) {
+	cs := ctx.CS
+	if !cs.sm.FirstHalfStarted() && !cs.sm.SecondHalfStarted() {
+		return
+	}
+	cs.HandlePauseCommand(ctx.Command.Name, ctx.Nickname, ctx.SteamID, ctx.Team)
+}
+
+func cmdLo3(ctx *CommandContext) {
+	force := len(ctx.Args) > 0 && ctx.Args[0] == "force"
+	Lo3(ctx, !force)
+}
+
+// Lo3 starts the next half. When checkAttendance is set it first makes sure every player is on the
+// server, going live from the callback once the status query has returned.
+func Lo3(ctx *CommandContext, checkAttendance bool) {
+	cs := ctx.CS
+	if cs.sm.KnifeRoundStarted() || len(cs.sm.GetKnifeWinner()) > 0 {
+		ctx.Reply("The knife round has not been completed yet.")
+		return
+	}
+
+	goingLive := !cs.sm.FirstHalfStarted() && !cs.sm.SecondHalfStarted() || cs.sm.FirstHalfStarted() && cs.sm.GetFirstHalfT() + cs.sm.GetFirstHalfCT() == 15
+	if goingLive && checkAttendance {
+		pugID := cs.pugID
+		cs.CheckAttendance(func() {
+			// the PUG may have ended while the server was queried
+			if cs.InUse && cs.pugID == pugID {
+				Lo3(ctx, false)
+			}
+		})
+		return
+	}
+
+	if !cs.sm.FirstHalfStarted() && !cs.sm.SecondHalfStarted() {
+		cs.sm.ResetRoundCounter()
+		cs.sm.SetFirstHalfStarted(true)
+	} else if cs.sm.FirstHalfStarted() && cs.sm.GetFirstHalfT() + cs.sm.GetFirstHalfCT() < 15 {
+		ctx.Reply("First half has already commenced. If you wish to cancel the first half, please type %s.", Cmd("cancelhalf"))
+		return
+	} else if cs.sm.FirstHalfStarted() && cs.sm.GetFirstHalfT() + cs.sm.GetFirstHalfCT() == 15 {
+		cs.sm.SetSecondHalfStarted(true)
+		ctx.Reply("The second half has begun!")
+		cs.SendToChannel("The second half has begun!")
+	}
+	cs.GoLive()
+}
+
+// CheckAttendance calls onAttendance if every player in the PUG is connected to the server,
+// otherwise it tells the players who is missing. Players that haven't linked their SteamID are only
+// counted.
+func (cs *CS) CheckAttendance(onAttendance func()) {
+	pug, success := GetPugByID(cs.pugID)
+	if !success {
+		onAttendance()
+		return
+	}
+
+	cs.QueryStatus(func(status ServerStatus, err error) {
+		if err != nil {
+			log.Printf("Unable to check attendance on %s, RCON status failed. Error: %s\n", cs.serverIP, err)
+			onAttendance()
+			return
+		}
+
+		if cs.IsAttending(pug, status) {
+			onAttendance()
+		}
+	})
+}
+
+// IsAttending returns true if every player in the PUG is in status, otherwise it tells the players
+// who is missing.
+func (cs *CS) IsAttending(pug *PUG, status ServerStatus) bool {
+	var missing []string
+	for _, player := range pug.GetPlayers() {
+		if steamID, linked := pug.GetSteamID(player); linked {
+			if _, connected := status.GetPlayerBySteamID(steamID); !connected {
+				missing = append(missing, player)
+			}
+		}
+	}
+
+	if len(missing) == 0 && status.Humans >= pug.GetPlayerCount() {
+		return true
+	}
+
+	message := fmt.Sprintf("Not all players are connected (%d/%d).", status.Humans, pug.GetPlayerCount())
+	if len(missing) > 0 {
+		message += " Missing: " + strings.Join(missing, " ") + "."
+	}
+	cs.Say("%s Type %s force to go live anyway.", message, Cmd("lo3"))
+	cs.SendToChannel("%s", message)
+	return false
+}
+
+func cmdKnife(ctx *CommandContext) {
+	cs := ctx.CS
+	if cs.sm.FirstHalfStarted() || cs.sm.SecondHalfStarted() || cs.sm.KnifeRoundStarted() || len(cs.sm.GetKnifeWinner()) > 0 {
+		ctx.Reply("The knife round can only be played before the match goes live.")
+		return
+	}
+	cs.StartKnifeRound()
+}
+
+func cmdRequest(ctx *CommandContext) {
+	cs := ctx.CS
+	ctx.Reply("Requesting for players on IRC.")
+	cs.SendToChannel("Need player! To join, use the connect string: connect %s; password %s", cs.serverIP, cs.serverPassword)
+}
+
+func cmdRestart(ctx *CommandContext) {
+	cs := ctx.CS
+	if cs.sm.FirstHalfStarted() || cs.sm.SecondHalfStarted() {
+		ctx.Reply("You are unable to restart the round once the game has gone live.")
+		return
+	}
+	cs.WriteData("mp_restartgame 1")
+}
+
+func cmdCancelHalf(ctx *CommandContext) {
+	cs := ctx.CS
+	if cs.sm.FirstHalfStarted() && !cs.sm.SecondHalfStarted() {
+		cs.sm.ResetRoundCounter()
+		cs.sm.SetFirstHalfStarted(false)
+		cs.sm.ResetPlayerStats()
+		cs.RelayGameEvents = false
+		cs.WriteData("mp_maxrounds 999")
+		ctx.Reply("First half has been cancelled. Please type %s once all players are ready.", Cmd("lo3"))
+		cs.SendToChannel("*** First half has been cancelled.")
+	} else if cs.sm.FirstHalfStarted() && cs.sm.SecondHalfStarted() {
+		cs.sm.ResetRoundCounter()
+		cs.sm.SetSecondHalfStarted(false)
+		cs.sm.ResetPlayerStats()
+		cs.RelayGameEvents = false
+		cs.WriteData("mp_maxrounds 999")
+		ctx.Reply("Second half has been cancelled. Please type %s once all players are ready.", Cmd("lo3"))
+		cs.SendToChannel("*** Second half has been cancelled.")
+	}
+}
+
+func cmdMap(ctx *CommandContext) {
+	cs := ctx.CS
+	if cs.sm.FirstHalfStarted() || cs.sm.SecondHalfStarted() {
+		ctx.Reply("You are unable to change the map once the game has gone live.")
+		return
+	}
+
+	mapName := ctx.Args[0]
+	if !IsValidMap(mapName) {
+		ctx.Reply("Invalid map selection. Please select a map from the following: %s ", GetValidMaps())
+		return
+	}
+
+	ctx.Reply("Changing map to '%s'.", mapName)
+	cs.WriteData("changelevel %s", mapName)
+	cs.SendToChannel("PUG admin changed level to %s", mapName)
+}
+
+func cmdIRC(ctx *CommandContext) {
+	s := strings.Join(ctx.Args, " ")
+	ctx.Reply("Sending message to IRC: %s.", s)
+	ctx.CS.SendToChannel("[CS]: %s", s)
+}
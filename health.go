@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	healthCheckInterval = 30 * time.Second
+	// a server with a PUG on it logs at least this often, even during warmup
+	logSilenceLimit = 5 * time.Minute
+)
+
+// ServerHealth is the result of the last health check of a server. It is only changed on the
+// owner goroutine.
+type ServerHealth struct {
+	healthy bool
+	lastLog, lastCheck time.Time
+	rconRTT time.Duration
+	rconError, infoError error
+	info A2SInfo
+}
+
+func (cs *CS) IsHealthy() bool {
+	return cs.health.healthy
+}
+
+// CheckHealth probes the server every healthCheckInterval, the results are applied on the owner
+// goroutine.
+func (cs *CS) CheckHealth() {
+	for {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+		_, rconError := cs.rcon.Exec(ctx, "echo")
+		cancel()
+		rtt := time.Since(start)
+
+		info, infoError := QueryInfo(cs.serverIP)
+
+		After(0, func() {
+			cs.SetHealth(rtt, rconError, info, infoError)
+		})
+		time.Sleep(healthCheckInterval)
+	}
+}
+
+func (cs *CS) SetHealth(rtt time.Duration, rconError error, info A2SInfo, infoError error) {
+	h := &cs.health
+	h.lastCheck = time.Now()
+	h.rconRTT = rtt
+	h.rconError = rconError
+	h.info = info
+	h.infoError = infoError
+
+	healthy := rconError == nil && infoError == nil && (!cs.InUse || time.Since(h.lastLog) < logSilenceLimit)
+	if healthy == h.healthy {
+		return
+	}
+
+	h.healthy = healthy
+	if healthy {
+		log.Printf("Server %d (%s) is healthy again and back in rotation.\n", cs.serverID, cs.serverIP)
+	} else {
+		log.Printf("Server %d (%s) is unhealthy and out of rotation: %s\n", cs.serverID, cs.serverIP, cs.GetHealthProblem())
+		if cs.InUse {
+			cs.SendToChannel("*** Server problem: %s.", cs.GetHealthProblem())
+		}
+	}
+}
+
+func (cs *CS) SetLogReceived() {
+	cs.health.lastLog = time.Now()
+}
+
+// GetHealthProblem describes why a server is unhealthy.
+func (cs *CS) GetHealthProblem() string {
+	h := &cs.health
+	if h.rconError != nil {
+		return fmt.Sprintf("RCON failed (%s)", h.rconError)
+	}
+
+	if h.infoError != nil {
+		return fmt.Sprintf("no reply to server queries (%s)", h.infoError)
+	}
+
+	if cs.InUse && time.Since(h.lastLog) >= logSilenceLimit {
+		return fmt.Sprintf("no logs received for %s", time.Since(h.lastLog).Round(time.Second))
+	}
+	return ""
+}
+
+// GetHealthSummary describes a server for !servers.
+func (cs *CS) GetHealthSummary() string {
+	h := &cs.health
+	summary := fmt.Sprintf("Server %d (%s, %s): ", cs.serverID, cs.serverIP, cs.region)
+
+	if h.lastCheck.IsZero() {
+		summary += "not checked yet"
+	} else if h.healthy {
+		summary += fmt.Sprintf("healthy, %s %d/%d players, RCON %s", h.info.Map, h.info.Players, h.info.MaxPlayers, h.rconRTT.Round(time.Millisecond))
+	} else {
+		summary += "OUT OF ROTATION, " + cs.GetHealthProblem()
+	}
+
+	if h.lastLog.IsZero() {
+		summary += ", no logs received"
+	} else {
+		summary += fmt.Sprintf(", last log %s ago", time.Since(h.lastLog).Round(time.Second))
+	}
+
+	if pug, success := GetPugByID(cs.pugID); success && cs.InUse {
+		summary += fmt.Sprintf(", in use by PUG #%d in %s", pug.GetNumber(), pug.GetIRCChannel())
+	} else if cs.InUse {
+		summary += ", in use"
+	} else {
+		summary += ", free"
+	}
+	return summary
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CS2 servers only send logs over HTTP, POSTing batches of lines to the URL given to
+// logaddress_add_http. Each server gets its own token in the URL, it can also be sent in an
+// X-Log-Token header by proxies that rewrite the path.
+
+const (
+	HTTP_LOG_PATH = "/logs/"
+	maxHTTPLogSize = 1 << 20
+)
+
+// CS2 lines look like `10/19/2026 - 21:30:05.123 - "name<2><[U:1:123]><CT>" say "hi"`
+var cs2LogLineRegex = regexp.MustCompile(`^(\d\d/\d\d/\d{4}) - (\d\d:\d\d:\d\d)(?:\.\d+)? - (.*)$`)
+
+var httpLogAddress string
+
+func GenerateLogToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		log.Fatalf("Unable to generate a log token. Error: %s\n", err)
+	}
+	return hex.EncodeToString(token)
+}
+
+func StartHTTPLogServer(listenAddress string) bool {
+	log.Printf("Starting HTTP log server on %s", listenAddress)
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		log.Printf("Unable to listen. Error: %s\n", err)
+		return false
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(HTTP_LOG_PATH, HandleHTTPLog)
+	server := &http.Server{Handler: mux, ReadTimeout: 30 * time.Second, WriteTimeout: 30 * time.Second}
+	go func() {
+		log.Printf("HTTP log server stopped. Error: %s\n", server.Serve(listener))
+	}()
+
+	httpLogAddress = listenAddress
+	log.Println("HTTP log server started successfully")
+	return true
+}
+
+// HandleHTTPLog receives a batch of log lines from a server and handles them on the owner
+// goroutine like the lines of UDP log packets.
+func HandleHTTPLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, HTTP_LOG_PATH)
+	if len(token) == 0 {
+		token = r.Header.Get("X-Log-Token")
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPLogSize))
+	if err != nil {
+		log.Printf("Dropped HTTP logs from %s. Error: %s\n", r.RemoteAddr, err)
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	status := http.StatusOK
+	Do(func() {
+		cs, success := GetServerByLogToken(token)
+		if !success {
+			log.Printf("Dropped HTTP logs from %s, the token doesn't belong to any server.\n", r.RemoteAddr)
+			status = http.StatusForbidden
+			return
+		}
+
+		if !cs.IsLogSender(net.ParseIP(host)) {
+			log.Printf("Dropped HTTP logs from %s, server %s logs from %s\n", r.RemoteAddr, cs.serverIP, cs.serverAddr.IP)
+			status = http.StatusForbidden
+			return
+		}
+
+		for _, line := range strings.Split(string(body), "\n") {
+			if line, success = NormaliseLogLine(line); success {
+				cs.HandleLogLine(line)
+			}
+		}
+	})
+
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+	}
+}
+
+// NormaliseLogLine converts a CS2 log line to the "L date - time: message" form of UDP logs.
+func NormaliseLogLine(line string) (string, bool) {
+	line = strings.TrimRight(line, "\r\x00")
+	if strings.HasPrefix(line, "L ") {
+		return line, true
+	}
+
+	match := cs2LogLineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+	return "L " + match[1] + " - " + match[2] + ": " + match[3], true
+}
+
+func GetServerByLogToken(token string) (*CS, bool) {
+	for i := range csManager {
+		if csManager[i].httpLog && csManager[i].logToken == token {
+			return csManager[i], true
+		}
+	}
+	return nil, false
+}
+
+func (cs *CS) GetHTTPLogURL() string {
+	return "http://" + cs.GetLogAddress() + HTTP_LOG_PATH + cs.logToken
+}
@@ -1,17 +1,33 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"fmt"
+	"math/rand"
 	"net"
 	"log"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 	"regexp"
 )
 
 var irc *IRC
 
+// prefix, command, middle parameters and trailing parameter, parameters can be a single character
+// as in "AUTHENTICATE +"
+var ircLineRegex = regexp.MustCompile(`^(?:[:](\S+) )?(\S+)(?: ([^:]\S*(?: [^:]\S*)*))?(?: [:](.+))?$`)
+
+const (
+	pingInterval = time.Minute
+	pingTimeout = 10 * time.Second
+	reconnectMinDelay = 5 * time.Second
+	reconnectMaxDelay = 5 * time.Minute
+)
+
 type Message struct {
 	nickname, host, destination, message string
 }
@@ -23,128 +39,243 @@ type IRC struct {
 	connected, ProtocolDebug bool
 	msg Message
 	pingTime time.Time
-	pingSent, pongReceived, joinedChannel bool
+	pingSent, pongReceived bool
+	// read by SendLoop, everything else is only used on the connection's goroutine
+	joinedChannel atomic.Bool
+	admins []string
+	channelUsers map[string]map[string]string
+	tlsConfig *tls.Config
+	saslMechanism, saslUsername, saslPassword string
+	configuredNickname, nickServPassword, nickServRecover string
+	registered, identified, identifyPending bool
+	identifyTimer *time.Timer
+	pendingJoins []Channels
+	queue *SendQueue
+	reader *bufio.Reader
 }
 
 func (irc *IRC) SendToChannel(channel, data string, v ...interface{}) {
 	buffer := fmt.Sprintf(data, v...)
-	s := fmt.Sprintf("PRIVMSG %s :%s\r\n", channel, buffer)
-	_, err := irc.socket.Write([]byte(s))
+	irc.QueueMessage(PRIORITY_NORMAL, channel, buffer)
+	log.Printf("Sending channel message: %s\n", buffer)
+}
 
-	if err != nil {
-		log.Println("Error, unable to send data.")
-		irc.connected = false
-	}
+func (irc *IRC) SendPrivate(nickname, data string, v ...interface{}) {
+	buffer := fmt.Sprintf(data, v...)
+	irc.QueueMessage(PRIORITY_PRIVATE, nickname, buffer)
+	log.Printf("Sending private message to %s: %s\n", nickname, buffer)
+}
 
-	log.Printf("Sending channel message: %s\n", buffer)
+// QueueMessage queues a PRIVMSG, splitting it into several lines if it wouldn't fit in one.
+func (irc *IRC) QueueMessage(priority int, target, message string) {
+	command := fmt.Sprintf("PRIVMSG %s :", target)
+	max := maxLineLength - len(command) - len("\r\n") - hostmaskReserve
+
+	for _, line := range SplitMessage(strings.TrimRight(message, "\r\n"), max) {
+		irc.queue.Push(priority, command + line + "\r\n")
+	}
 }
 
 func (irc *IRC) WriteData(data string, v ...interface{}) {
 	buffer := fmt.Sprintf(data, v...)
-	_, err := irc.socket.Write([]byte(buffer))
+	irc.queue.Push(PRIORITY_HIGH, buffer)
 
-	if err != nil {
-		log.Println("Error, unable to send data.")
-		irc.connected = false
+	buffer = strings.Trim(buffer, "\r\n")
+	log.Printf("Sending: %s\n", RedactLine(buffer))
+}
+
+// RedactLine hides the credentials in a line sent to the IRC server so they don't end up in the log.
+func RedactLine(line string) string {
+	if strings.HasPrefix(line, "AUTHENTICATE ") {
+		return "AUTHENTICATE <redacted>"
 	}
 
-	buffer = strings.Trim(buffer, "\r\n")
-	log.Printf("Sending: %s\n", buffer)
+	// IDENTIFY, GHOST, RECOVER and RELEASE carry the NickServ password, only the command is kept
+	if prefix := "PRIVMSG NickServ :"; len(line) > len(prefix) && strings.EqualFold(line[:len(prefix)], prefix) {
+		command, _, _ := strings.Cut(line[len(prefix):], " ")
+		return prefix + command + " <redacted>"
+	}
+	return line
 }
 
-func (irc *IRC) IRCLoop() {
+// SendLoop writes queued lines to the IRC server at the rate the flood control allows. Channel and
+// private messages are held back until the channels have been joined, so anything queued while
+// disconnected is sent once the bot is back in its channels.
+func (irc *IRC) SendLoop(ctx context.Context, disconnect context.CancelFunc, conn net.Conn) {
 	for {
-		if (!irc.connected) {
-			if irc.ConnectToServer() {
-				log.Println("Connected to IRC server!")
+		line, success := irc.queue.Next(ctx, irc.MaxSendPriority)
+		if !success {
+			log.Println("Exiting send loop routine")
+			return
+		}
 
-				if (len(irc.password) > 0) {
-					irc.WriteData("PASS %s\r\n", irc.password)
-				}
+		irc.queue.TakeToken()
+		_, err := conn.Write([]byte(line))
 
-				irc.WriteData("NICK %s\r\n", irc.nickname)
-				irc.WriteData("USER %s %s %s %s\r\n", irc.username, irc.username, irc.username, irc.username)
-				log.Println("Starting ping check loop...")
-
-				go irc.PingLoop()
-
-				for {
-					if (!irc.connected) {
-						log.Println("Connection to IRC server has been lost.")
-						break
-					} else {
-						irc.RecvData()
-					}
-				} 
-			} else {
-				log.Println("Sleeping for 5 minutes before reconection.")
-				time.Sleep(time.Minute * 5)
-			}
+		if err != nil {
+			log.Println("Error, unable to send data.")
+			disconnect()
+			return
 		}
 	}
 }
 
-func (irc *IRC) PingLoop() {
+func (irc *IRC) MaxSendPriority() int {
+	if irc.joinedChannel.Load() {
+		return PRIORITY_NORMAL
+	}
+	return PRIORITY_HIGH
+}
+
+func (irc *IRC) Run() {
+	log.Println("Starting main IRC loop..")
+	irc.IRCLoop()
+}
+
+func (irc *IRC) IRCLoop() {
+	delay := reconnectMinDelay
+
 	for {
-		if !irc.connected {
-			log.Println("Exiting ping loop routine")
-			break
+		if irc.ConnectToServer() {
+			log.Println("Connected to IRC server!")
+			irc.RunConnection()
+			log.Println("Connection to IRC server has been lost.")
+
+			if irc.registered {
+				delay = reconnectMinDelay
+			}
 		}
 
-		if !irc.joinedChannel {
-			time.Sleep(time.Second * 30)
-			continue
+		wait := delay / 2 + time.Duration(rand.Int63n(int64(delay / 2) + 1))
+		log.Printf("Reconnecting to IRC in %s.\n", wait)
+		time.Sleep(wait)
+
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
 		}
+	}
+}
+
+// RunConnection registers with the IRC server and handles its messages until the connection is
+// lost, then stops the goroutines started for it.
+func (irc *IRC) RunConnection() {
+	ctx, disconnect := context.WithCancel(context.Background())
+	defer disconnect()
+
+	irc.nickname = irc.configuredNickname
+	irc.registered = false
+	irc.identified = false
+	irc.identifyPending = false
+	irc.StopIdentifyTimer()
+	defer irc.StopIdentifyTimer()
+	irc.joinedChannel.Store(false)
+	irc.pingSent = false
+	irc.pongReceived = false
+	irc.pendingJoins = nil
+	irc.channelUsers = nil
+	irc.queue.Clear(PRIORITY_HIGH)
+
+	if (len(irc.saslMechanism) > 0) {
+		irc.WriteData("CAP REQ :sasl\r\n")
+	}
+
+	if (len(irc.password) > 0) {
+		irc.WriteData("PASS %s\r\n", irc.password)
+	}
+
+	irc.WriteData("NICK %s\r\n", irc.nickname)
+	irc.WriteData("USER %s %s %s %s\r\n", irc.username, irc.username, irc.username, irc.username)
+
+	lines := make(chan string)
+	go irc.SendLoop(ctx, disconnect, irc.socket)
+	go irc.RecvLoop(ctx, disconnect, irc.reader, lines)
+
+	pingTicker := time.NewTicker(pingInterval)
+	defer pingTicker.Stop()
+	var pongTimeout <-chan time.Time
 
-		if !irc.pingSent {
-			irc.pingTime = time.Now()
-			irc.WriteData("PING :TIMEOUTCHECK\r\n")
-			irc.pingSent = true
-			irc.pongReceived = false
-		} else {
-			if time.Since(irc.pingTime) / time.Second >= 10 && !irc.pongReceived {
-				log.Println("IRC connection has timed out.")
+	for {
+		select {
+			case <-ctx.Done():
+				irc.CloseConnection()
 				irc.connected = false
-				break
-			} else if irc.pongReceived {
+				return
+			case line := <-lines:
+				irc.HandleIRCEvents(line)
+			case <-pingTicker.C:
+				if irc.SendPing() {
+					pongTimeout = time.After(pingTimeout)
+				}
+			case <-pongTimeout:
+				pongTimeout = nil
+				// a reply that arrived while we were busy may still be waiting to be handled
+				select {
+					case line := <-lines:
+						irc.HandleIRCEvents(line)
+					default:
+				}
+
+				if !irc.pongReceived {
+					log.Println("IRC connection has timed out.")
+					disconnect()
+					continue
+				}
+
 				log.Println("Received pong to our ping.")
 				irc.pingSent = false
-				irc.pongReceived = false
-				time.Sleep(time.Minute)
-			}
+			case <-irc.IdentifyTimeout():
+				irc.identifyTimer = nil
+				if irc.identifyPending {
+					log.Println("NickServ did not confirm identification, joining channels anyway.")
+					irc.JoinChannels()
+				}
 		}
 	}
 }
 
+// SendPing checks the connection is alive once the channels have been joined, and tries to reclaim
+// our nickname if we had to use another one. It returns true if a PING was sent.
+func (irc *IRC) SendPing() bool {
+	if !irc.joinedChannel.Load() || irc.pingSent {
+		return false
+	}
+
+	if irc.nickname != irc.configuredNickname {
+		log.Printf("Attempting to reclaim nickname %s\n", irc.configuredNickname)
+		irc.RecoverNickname()
+	}
+
+	irc.pingTime = time.Now()
+	irc.pongReceived = false
+	irc.pingSent = true
+	irc.WriteData("PING :TIMEOUTCHECK\r\n")
+	return true
+}
+
 func (irc *IRC) CloseConnection() {
 	irc.socket.Close()
 }
 
-func (irc *IRC) RecvData() {
-	var completedBuffer = ""
-
+func (irc *IRC) RecvLoop(ctx context.Context, disconnect context.CancelFunc, reader *bufio.Reader, lines chan<- string) {
 	for {
-		readBuffer := make([]byte, 1)
-		_, err := irc.socket.Read(readBuffer)
+		line, err := reader.ReadString('\n')
 
 		if err != nil {
 			log.Println("Error, unable to receive data.")
-			irc.connected = false
+			disconnect()
 			return
 		}
 
-		s := string(readBuffer)
+		line = strings.Trim(line, "\r\n")
+		log.Printf("Received: %s\n", line)
 
-		if strings.Contains(completedBuffer, "\r") {
-			break
-		} else {
-			completedBuffer += s
+		select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
 		}
 	}
-
-	completedBuffer = strings.Trim(completedBuffer, "\r\n")
-	log.Printf("Received: %s\n", completedBuffer)
-	irc.HandleIRCEvents(completedBuffer)
 }
 
 func (irc *IRC) ConnectToServer() bool {
@@ -159,30 +290,117 @@ func (irc *IRC) ConnectToServer() bool {
 	}
 
 	log.Printf("Attempting connection to %s..\n", irc.server)
-	irc.socket, err = net.Dial("tcp", irc.server)
+	if irc.tlsConfig != nil {
+		irc.socket, err = tls.Dial("tcp", irc.server, irc.tlsConfig)
+	} else {
+		irc.socket, err = net.Dial("tcp", irc.server)
+	}
 
 	if err != nil {
-		log.Println("Error, unable to connect.")
+		log.Printf("Error, unable to connect. Error: %s\n", err)
 		return false
 	}
 
+	irc.reader = bufio.NewReader(irc.socket)
 	irc.connected = true
 	return true
 }
 
+// SetChannelUser records a channel user along with the channel modes (q, a, o, h or v) they hold.
+func (irc *IRC) SetChannelUser(channel, nickname, modes string) {
+	if irc.channelUsers == nil {
+		irc.channelUsers = make(map[string]map[string]string)
+	}
+
+	channel = strings.ToLower(channel)
+	if irc.channelUsers[channel] == nil {
+		irc.channelUsers[channel] = make(map[string]string)
+	}
+	irc.channelUsers[channel][nickname] = modes
+}
+
+func (irc *IRC) RemoveChannelUser(channel, nickname string) {
+	if len(channel) > 0 {
+		delete(irc.channelUsers[strings.ToLower(channel)], nickname)
+		return
+	}
+
+	for c := range irc.channelUsers {
+		delete(irc.channelUsers[c], nickname)
+	}
+}
+
+func (irc *IRC) RenameChannelUser(oldNick, newNick string) {
+	for c := range irc.channelUsers {
+		if modes, success := irc.channelUsers[c][oldNick]; success {
+			delete(irc.channelUsers[c], oldNick)
+			irc.channelUsers[c][newNick] = modes
+		}
+	}
+}
+
+// SetChannelUserMode applies a MODE change such as "+ov nick1 nick2" to the tracked channel users.
+func (irc *IRC) SetChannelUserMode(channel, modes string, params []string) {
+	add := true
+	for _, mode := range modes {
+		switch {
+			case mode == '+' || mode == '-':
+				add = mode == '+'
+			case strings.ContainsRune("qaohv", mode):
+				if len(params) == 0 {
+					return
+				}
+				nickname := params[0]
+				params = params[1:]
+
+				current := strings.Replace(irc.channelUsers[strings.ToLower(channel)][nickname], string(mode), "", -1)
+				if add {
+					current += string(mode)
+				}
+				irc.SetChannelUser(channel, nickname, current)
+			case strings.ContainsRune("beIk", mode) || (mode == 'l' && add):
+				if len(params) > 0 {
+					params = params[1:]
+				}
+		}
+	}
+}
+
+func (irc *IRC) IsChannelOpOrVoice(channel, nickname string) bool {
+	return len(irc.channelUsers[strings.ToLower(channel)][nickname]) > 0
+}
+
+// IsPrivileged reports whether a user may issue admin commands in a channel, either by holding
+// op or voice in the channel or by matching one of the configured admin hostmasks.
+func (irc *IRC) IsPrivileged(channel, nickname, hostmask string) bool {
+	if irc.IsChannelOpOrVoice(channel, nickname) {
+		return true
+	}
+
+	for i := range irc.admins {
+		if MatchHostmask(irc.admins[i], hostmask) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchHostmask matches a nick!user@host against a mask which may contain * and ? wildcards.
+func MatchHostmask(mask, hostmask string) bool {
+	pattern := regexp.QuoteMeta(strings.ToLower(mask))
+	pattern = strings.Replace(pattern, `\*`, ".*", -1)
+	pattern = strings.Replace(pattern, `\?`, ".", -1)
+	matched, err := regexp.MatchString("^"+pattern+"$", strings.ToLower(hostmask))
+	return err == nil && matched
+}
+
 func (irc *IRC) HandleIRCEvents(ircBuffer string) {
 	if irc.ProtocolDebug {
 		log.Printf("ircBuffer size: %d\n", len(ircBuffer))
 		log.Printf("ircBuffer = %s\n", ircBuffer)
 	}
 
-	r, err := regexp.Compile(`^(?:[:](\S+) )?(\S+)(?: ([^:].+?))?(?: [:](.+))?$`)
-	if err != nil {
-		log.Println("Error, regex string wasn't able to compile")
-		return
-	}
-
-	matches := r.FindAllStringSubmatch(ircBuffer, -1)
+	matches := ircLineRegex.FindAllStringSubmatch(ircBuffer, -1)
 	if len(matches) == 0 {
 		log.Printf("No match found for: %s\n", ircBuffer)
 		return
@@ -191,61 +409,92 @@ func (irc *IRC) HandleIRCEvents(ircBuffer string) {
 	for _, match := range matches {
 		switch match[2] {
 		case "001":
-			for i := 0; i < len(irc.ircChannels); i++ {
-				irc.WriteData("JOIN %s %s\r\n", irc.ircChannels[i].Channel, irc.ircChannels[i].Password)
-			}
-			irc.joinedChannel = true
+			irc.registered = true
+			irc.nickname = strings.Fields(match[3])[0]
+			irc.IdentifyNickname()
 			irc.WriteData("USERHOST %s\r\n", irc.nickname)
-		case "433":
-			irc.nickname = irc.nickname + "`"
-			irc.WriteData("NICK %s\r\n", irc.nickname)
+		case "CAP", "AUTHENTICATE", "900", "902", "903", "904", "905", "906", "908":
+			irc.HandleSASL(match)
+			if match[2] == "900" {
+				irc.HandleNickServ(match)
+			}
+		case "433", "477", "NOTICE":
+			irc.HandleNickServ(match)
 		case "302":
 			irc.externalIP = strings.Split(match[4], "@")[1]
 			log.Printf("Received external IP: %s\n", irc.externalIP)
+			externalIP := irc.externalIP
+			After(0, func() {
+				SetExternalIP(externalIP)
+			})
 		case "PING":
 			irc.WriteData("%s\r\n", strings.Replace(match[0], "PING", "PONG", 1))
 		case "PONG":
 			if match[4] == "TIMEOUTCHECK" {
 				irc.pongReceived = true
 			}
+		case "353":
+			params := strings.Fields(match[3])
+			channel := params[len(params)-1]
+			for _, name := range strings.Fields(match[4]) {
+				modes := ""
+				for len(name) > 0 && strings.ContainsRune("~&@%+", rune(name[0])) {
+					modes += string("qaohv"[strings.IndexByte("~&@%+", name[0])])
+					name = name[1:]
+				}
+				irc.SetChannelUser(channel, name, modes)
+			}
+		case "MODE":
+			params := strings.Fields(match[3])
+			if len(match[4]) > 0 {
+				params = append(params, match[4])
+			}
+			if len(params) < 2 || !strings.HasPrefix(params[0], "#") {
+				return
+			}
+			irc.SetChannelUserMode(params[0], params[1], params[2:])
+		case "JOIN":
+			nickname := strings.Split(match[1], "!")[0]
+			channel := match[3]
+			if len(channel) == 0 {
+				channel = match[4]
+			}
+			irc.SetChannelUser(channel, nickname, "")
+		case "KICK":
+			params := strings.Fields(match[3])
+			if len(params) < 2 {
+				return
+			}
+			irc.RemoveChannelUser(params[0], params[1])
 		case "NICK":
 			nickname := strings.Split(match[0], "!")[0]
 			nickname = nickname[1:]
-			pug, success := GetPugByPlayer(nickname)
+			if len(match[4]) == 0 {
+				match[4] = match[3]
+			}
+			irc.RenameChannelUser(nickname, match[4])
 
-			if !success {
+			if nickname == irc.nickname {
+				log.Printf("Nickname changed to %s\n", match[4])
+				irc.nickname = match[4]
+				if irc.nickname == irc.configuredNickname && len(irc.nickServPassword) > 0 && !irc.identified {
+					irc.WriteData("PRIVMSG NickServ :IDENTIFY %s %s\r\n", irc.configuredNickname, irc.nickServPassword)
+				}
 				return
 			}
-
-			pug.UpdatePlayerNickname(nickname, match[4])
+			Do(func() { HandleChatNickChange(nickname, match[4]) })
 		case "PART", "QUIT":
 			nickname := strings.Split(match[0], "!")[0]
 			nickname = nickname[1:]
-			pug, success := GetPugByPlayer(nickname)
-
-			if !success {
-				return
-			}
-
-			channel := pug.GetIRCChannel()
-
-			if pug.LeavePug(nickname) && !pug.PugActive() {
-				if pug.GetPlayerCount() == 0 {
-					irc.SendToChannel(channel, "The PUG admin has left the PUG and there are no other plays to assign the admin rights to. Type !pug <map> to start a new one.")
-					pug.EndPug()
-					DeletePug(pug.GetPugID())
-					cs, _ := GetServerByChannel(channel)
-					cs.SetInUseStatus(false)
-					cs.SetIRCChannel("")
-				} else {
-					if pug.GetAdmin() == nickname {
-						pug.AssignNewAdmin()
-						irc.SendToChannel(channel, "The PUG administrator has left the pug and %s has been asigned as the PUG admin.", pug.GetAdmin())
-					} else {
-						irc.SendToChannel(channel, "%s has left the pug, [%d/10]", nickname, pug.GetPlayerCount())
-					}
+			channel := ""
+			if match[2] == "PART" {
+				channel = match[3]
+				if len(channel) == 0 {
+					channel = match[4]
 				}
 			}
+			irc.RemoveChannelUser(channel, nickname)
+			Do(func() { HandleChatPart(channel, nickname) })
 		case "PRIVMSG":
 			nickname := strings.Split(match[1], "!")[0]
 			host := strings.Split(match[1], "@")[1]
@@ -258,121 +507,7 @@ func (irc *IRC) HandleIRCEvents(ircBuffer string) {
 				return;
 			}
 
-			_, pugStarted := GetPugByChannel(destination)
-
-			if message[0] == "!pug" {
-				if pugStarted {
-					irc.SendToChannel(destination, "A PUG has already been started, please wait until the next PUG has started.")
-					return
-				}
-
-				cs, success := GetFreeServer("Sydney") // to-do - obtain channel region
-					
-				if !success {
-					irc.SendToChannel(destination, "Unable to discover any available servers with specified region.")
-					return
-				}
-
-				cs.SetInUseStatus(true)
-				cs.SetIRCChannel(destination)
-				
-				p := &PUG{}
-
-				if len(message) > 1 {
-					s := message[1]
-					if !IsValidMap(s) {
-						p.SetMap("de_dust2")
-					} else {
-						p.SetMap(s)
-					}
-				}
-
-				irc.SendToChannel(destination, "A PUG has been started on map %s, type !join to join the pug", p.GetMap())
-				log.Printf("Assigned server ID, region %s to pug ID %d with channel %s\n", cs.GetRegion(), p.GetPugID(), destination)
-				cs.WriteData("changelevel %s", p.GetMap())
-				cs.serverPassword = p.GenerateRandomPassword("pug")
-				cs.WriteData("sv_password %s", cs.serverPassword)
-				cs.pugAdminPassword = p.GenerateRandomPassword("admin")
-				p.StartPug()
-				p.SetIRCChannel(destination)
-				p.JoinPug(nickname)
-				NewPug(p)
-			} else if message[0] == "!join" {
-				if pugStarted {
-					pug, _ := GetPugByChannel(destination)
-					if pug.JoinPug(nickname) && !pug.PugActive() {
-						irc.SendToChannel(destination, "%s has joined the pug! [%d/10]", nickname, pug.GetPlayerCount())
-						if pug.GetPlayerCount() < 10 {
-							return
-						}
-						irc.SendToChannel(destination, "The PUG is now full! The server information will be messaged to you.")
-						pug.RandomisePlayerList()
-						pug.SetPugActive(true)
-						
-						players := pug.GetPlayers()
-						irc.SendToChannel(destination, "The teams are as follows. Terrorists: %s Counter-Terrorists: %s", strings.Join(players[0:5], " "), strings.Join(players[5:10], " "))
-						cs, _ := GetServerByChannel(destination)
-						cs.WriteData("mp_maxrounds 999")
-
-						for i := range players {
-							if players[i] == pug.GetAdmin() {
-								irc.WriteData("PRIVMSG %s :PUG details are: connect %s; password %s. PUG Admin password: %s (type !login <password> in game and !lo3 once all players are ready).\r\n", players[i], cs.serverIP, cs.serverPassword, cs.pugAdminPassword)
-							} else {
-								irc.WriteData("PRIVMSG %s :PUG details are: connect %s; password %s.\r\n", players[i], cs.serverIP, cs.serverPassword)
-							}
-						}
-					}
-				} else {
-					irc.SendToChannel(destination, "A PUG has not been started, type !pug <map> to start a new one.")
-					return
-				}
-			} else if message[0] == "!leave" {
-				if pugStarted {
-					pug, _ := GetPugByChannel(destination)
-					if pug.LeavePug(nickname) && !pug.PugActive() {
-						if pug.GetPlayerCount() == 0 {
-							irc.SendToChannel(destination, "The PUG admin has left the PUG and there are no other plays to assign the admin rights to. Type !pug <map> to start a new one.")
-							pug.EndPug()
-							DeletePug(pug.GetPugID())
-							cs, _ := GetServerByChannel(destination)
-							cs.SetInUseStatus(false)
-							cs.SetIRCChannel("")
-						} else {
-							if pug.GetAdmin() == nickname {
-								pug.AssignNewAdmin()
-								irc.SendToChannel(destination, "The PUG administrator has left the pug and %s has been asigned as the PUG admin.", pug.GetAdmin())
-							} else {
-								irc.SendToChannel(destination, "%s has left the pug, [%d/10]", nickname, pug.GetPlayerCount())
-							}
-						}
-					}
-				} else {
-					irc.SendToChannel(destination, "A PUG has not been started, type !pug <map> to start a new one.")
-					return
-				}
-			} else if message[0] == "!stats" {
-				irc.SendToChannel(destination, "Stats for player %s can be visited here: http://www.cs-stats.com/player/xxxxxx", nickname)
-				return
-			} else if message[0] == "!players" {
-				if pugStarted {
-					pug, _ := GetPugByChannel(destination)
-					irc.SendToChannel(destination, "Player list: %s [%d/10]", strings.Join(pug.GetPlayers(), " "), pug.GetPlayerCount())
-					return
-				}
-			} else if message[0] == "!say" {
-				if len(message) > 1 {
-					cs, success := GetServerByChannel(destination)
-					
-					if !success {
-						log.Println("Unable to find server")
-						return
-					}
-
-					s := strings.Join(message[1:], " ")
-					cs.WriteData("say [IRC] %s", s)
-					irc.SendToChannel(destination, "Sent message to CS server.")
-				}
-			}
+			Do(func() { HandleChatCommand(destination, nickname, match[1], message) })
 		}
 	}
 }
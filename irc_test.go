@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIRCLineRegex(t *testing.T) {
+	tests := []struct {
+		line string
+		expected []string
+	}{
+		{"AUTHENTICATE +", []string{"", "AUTHENTICATE", "+", ""}},
+		{":irc.example.net AUTHENTICATE +", []string{"irc.example.net", "AUTHENTICATE", "+", ""}},
+		{":irc.example.net CAP * ACK :sasl", []string{"irc.example.net", "CAP", "* ACK", "sasl"}},
+		{":nick!user@host PRIVMSG #pug :!add 1", []string{"nick!user@host", "PRIVMSG", "#pug", "!add 1"}},
+		{":nick!user@host MODE #pug +o bot", []string{"nick!user@host", "MODE", "#pug +o bot", ""}},
+		{"PING :irc.example.net", []string{"", "PING", "", "irc.example.net"}},
+	}
+
+	for _, test := range tests {
+		match := ircLineRegex.FindStringSubmatch(test.line)
+		if match == nil {
+			t.Errorf("%q did not match", test.line)
+			continue
+		}
+
+		for i := range test.expected {
+			if match[i+1] != test.expected[i] {
+				t.Errorf("%q matched %q, expected %q", test.line, match[1:], test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestRedactLine(t *testing.T) {
+	tests := []struct {
+		line, expected string
+	}{
+		{"AUTHENTICATE YWNjdABhY2N0AHNlY3JldHB3", "AUTHENTICATE <redacted>"},
+		{"PRIVMSG NickServ :IDENTIFY PugBot pw", "PRIVMSG NickServ :IDENTIFY <redacted>"},
+		{"PRIVMSG NickServ :GHOST PugBot pw", "PRIVMSG NickServ :GHOST <redacted>"},
+		{"PRIVMSG nickserv :RELEASE PugBot pw", "PRIVMSG NickServ :RELEASE <redacted>"},
+		{"PRIVMSG #pug :IDENTIFY yourself", "PRIVMSG #pug :IDENTIFY yourself"},
+		{"JOIN #pug", "JOIN #pug"},
+	}
+
+	for _, test := range tests {
+		if redacted := RedactLine(test.line); redacted != test.expected {
+			t.Errorf("RedactLine(%q) returned %q, expected %q", test.line, redacted, test.expected)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// how long the startup self-test waits for the first log line
+const logTestTimeout = 15 * time.Second
+
+var chatChannels []Channels
+
+func SetChatChannels(channels []Channels) {
+	chatChannels = channels
+}
+
+// GetLogAddress returns the address the server should send its logs to. Without a LogAddress
+// override this is the bot's side of the RCON connection, unless the server is on a public address
+// and the bot's is private, in which case the bot is behind NAT and its external IP is used.
+func (cs *CS) GetLogAddress() string {
+	if len(cs.logAddress) > 0 {
+		return cs.logAddress
+	}
+
+	_, port, _ := net.SplitHostPort(cs.listenAddress)
+	ip := cs.localIP
+
+	if !IsPrivateAddress(cs.serverAddr.IP) && IsPrivateAddress(net.ParseIP(cs.localIP)) {
+		if len(cs.externalIP) > 0 {
+			ip = cs.externalIP
+		} else {
+			log.Printf("Server %s has a public address but the bot's address %s is private and its external IP isn't known yet. Set LogAddress if no logs arrive.\n", cs.serverIP, cs.localIP)
+		}
+	}
+	return net.JoinHostPort(ip, port)
+}
+
+func IsPrivateAddress(ip net.IP) bool {
+	return ip != nil && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast())
+}
+
+// SetExternalIP records the bot's external IP, as seen by the IRC server, and points any server
+// that needs it at the new log address.
+func SetExternalIP(externalIP string) {
+	if net.ParseIP(externalIP) == nil {
+		log.Printf("External IP %s is not an IP address, ignoring it.\n", externalIP)
+		return
+	}
+
+	for _, cs := range csManager {
+		cs.externalIP = externalIP
+		if len(cs.enabledLogAddress) > 0 && cs.GetLogAddress() != cs.enabledLogAddress {
+			cs.EnableLogging()
+			cs.TestLogging()
+		}
+	}
+}
+
+// TestLogging warns in the log and in the server's channels if no log lines arrive shortly after
+// logging is enabled, which usually means the server can't reach the log address.
+func (cs *CS) TestLogging() {
+	start := time.Now()
+	address := cs.enabledLogAddress
+	// the server logs the RCON commands it runs, so this should produce a line straight away
+	cs.WriteData("echo PugBot log test")
+
+	After(logTestTimeout, func() {
+		if cs.health.lastLog.After(start) || address != cs.enabledLogAddress {
+			return
+		}
+
+		log.Printf("WARNING: No logs received from server %s within %s of sending them to %s. Check the server can reach that address or set LogAddress.\n", cs.serverIP, logTestTimeout, address)
+		for _, channel := range GetChannelsByRegion(cs.region) {
+			chat.SendToChannel(channel, "*** Warning: server %d (%s) isn't sending its logs to %s, PUGs on it won't work.", cs.serverID, cs.serverIP, address)
+		}
+	})
+}
+
+func GetChannelsByRegion(region string) []string {
+	channels := []string{}
+	for _, c := range chatChannels {
+		if strings.EqualFold(c.Region, region) {
+			channels = append(channels, c.Channel)
+		}
+	}
+	return channels
+}
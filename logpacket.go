@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"log"
+	"math"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Log packets are 0xFFFFFFFF, then R and the log lines, or S, the sv_logsecret value and the log
+// lines when the server has a log secret set. Each line ends with a newline and the packet with a
+// NUL.
+
+// the largest UDP payload, servers don't split long lines across packets
+const maxLogPacketSize = 65535
+
+var (
+	ErrLogBadHeader = errors.New("log packet has an invalid header")
+	ErrLogUnsigned = errors.New("log packet is not signed with the log secret")
+	ErrLogBadSecret = errors.New("log packet has the wrong log secret")
+)
+
+// GenerateLogSecret returns a random value for sv_logsecret.
+func GenerateLogSecret() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt32))
+	if err != nil {
+		log.Fatalf("Unable to generate a log secret. Error: %s\n", err)
+	}
+	return strconv.FormatInt(n.Int64() + 1, 10)
+}
+
+// IsLogSender checks that a log packet was sent from the server's address.
+func (cs *CS) IsLogSender(ip net.IP) bool {
+	return cs.serverAddr != nil && cs.serverAddr.IP.Equal(ip)
+}
+
+// ReadLogPacket returns the log lines in a packet, checking it is signed with the server's log
+// secret. Servers that log quickly batch several lines into one packet, lines that aren't log
+// lines are logged and skipped.
+func (cs *CS) ReadLogPacket(packet []byte) ([]string, error) {
+	if len(packet) < 5 || string(packet[:4]) != "\xFF\xFF\xFF\xFF" {
+		return nil, ErrLogBadHeader
+	}
+
+	data := string(packet[5:])
+	switch packet[4] {
+		case 'S':
+			if !strings.HasPrefix(data, cs.logSecret + "L ") {
+				return nil, ErrLogBadSecret
+			}
+			data = data[len(cs.logSecret):]
+		case 'R':
+			return nil, ErrLogUnsigned
+		default:
+			return nil, ErrLogBadHeader
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r\x00")
+		if len(line) == 0 {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "L ") {
+			log.Printf("Skipped a malformed log line from server %s: %q\n", cs.serverIP, line)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// GetServerByLogPacket finds the server a packet on the shared listener came from by its log
+// secret, or by the address it was sent from when it isn't signed with a known secret.
+func GetServerByLogPacket(addr *net.UDPAddr, packet []byte) (*CS, bool) {
+	if len(packet) > 5 && packet[4] == 'S' {
+		secret, _, _ := strings.Cut(string(packet[5:]), "L ")
+		for i := range csManager {
+			if csManager[i].SrvSocket == nil && !csManager[i].httpLog && csManager[i].logSecret == secret {
+				return csManager[i], true
+			}
+		}
+	}
+
+	for i := range csManager {
+		if csManager[i].SrvSocket == nil && !csManager[i].httpLog && csManager[i].serverAddr.IP.Equal(addr.IP) && csManager[i].serverAddr.Port == addr.Port {
+			return csManager[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadLogPacket(t *testing.T) {
+	cs := &CS{serverIP: "127.0.0.1:27015", logSecret: "12345"}
+	line := `L 10/19/2026 - 21:30:05: "alice<2><STEAM_1:0:111><CT>" say "hi"`
+	other := `L 10/19/2026 - 21:30:06: World triggered "Round_Start"`
+
+	tests := []struct {
+		name string
+		packet string
+		lines []string
+		err error
+	}{
+		{"short packet", "\xFF\xFF\xFF\xFF", nil, ErrLogBadHeader},
+		{"bad header", "\xFE\xFF\xFF\xFFS12345" + line + "\n\x00", nil, ErrLogBadHeader},
+		{"unknown type", "\xFF\xFF\xFF\xFFQ12345" + line + "\n\x00", nil, ErrLogBadHeader},
+		{"unsigned", "\xFF\xFF\xFF\xFFR" + line + "\n\x00", nil, ErrLogUnsigned},
+		{"wrong secret", "\xFF\xFF\xFF\xFFS54321" + line + "\n\x00", nil, ErrLogBadSecret},
+		{"secret prefix", "\xFF\xFF\xFF\xFFS123456" + line + "\n\x00", nil, ErrLogBadSecret},
+		{"single line", "\xFF\xFF\xFF\xFFS12345" + line + "\n\x00", []string{line}, nil},
+		{"no trailing newline", "\xFF\xFF\xFF\xFFS12345" + line + "\x00", []string{line}, nil},
+		{"batched", "\xFF\xFF\xFF\xFFS12345" + line + "\r\n" + other + "\n\x00", []string{line, other}, nil},
+		{"batched with garbage", "\xFF\xFF\xFF\xFFS12345" + line + "\n\x01\x02garbage\n\n" + other + "\n\x00", []string{line, other}, nil},
+	}
+
+	for _, test := range tests {
+		lines, err := cs.ReadLogPacket([]byte(test.packet))
+		if err != test.err {
+			t.Errorf("%s: ReadLogPacket returned %v, expected %v", test.name, err, test.err)
+			continue
+		}
+
+		if err == nil && !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("%s: ReadLogPacket returned %q, expected %q", test.name, lines, test.lines)
+		}
+	}
+}
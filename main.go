@@ -4,6 +4,7 @@ import (
 	"time"
 	"log"
 	"strings"
+	"sync/atomic"
 )
 
 func main() {
@@ -19,31 +20,70 @@ func main() {
 	SetAllowedMaps(strings.Split(config.CSMaps, ","))
 	SetTeamName(strings.Split(config.TeamNames, ","))
 	log.Println("Set available maps: " + GetValidMaps())
+	SetCommandPrefix(config.CommandPrefix)
+	SetChatChannels(config.IRCChannels)
+	RegisterHelpCommand()
+	RegisterChatCommands()
+	RegisterAdminCommands()
+	RegisterGameCommands()
+
+	if config.ChatTransport == "console" {
+		log.Println("Using the console chat transport.")
+		chat = &Console{}
+	} else {
+		tlsConfig, err := NewTLSConfig(config)
+
+		if err != nil {
+			log.Println("Fatal error loading the IRC TLS client certificate. Error: ", err)
+			return;
+		}
+
+		irc = &IRC{
+			config.IRCServer, //server
+			config.IRCPassword, //password
+			config.IRCNickname,  //nickname
+			config.IRCUsername, //username
+			"", //internal IP
+			"", //external IP
+			config.IRCChannels, //channel
+			nil,  // net.Conn
+			false, //irc connected
+			false, //irc protocol debug
+			Message{},
+			time.Now(), // pingTime
+			false, //ping sent
+			false, //pong received 
+			atomic.Bool{}, //joined channel
+			config.IRCAdmins, //admin hostmasks
+			nil, //channel users
+			tlsConfig, //TLS config
+			config.IRCSASLMechanism, //SASL mechanism
+			config.IRCSASLUsername, //SASL username
+			config.IRCSASLPassword, //SASL password
+			config.IRCNickname, //configured nickname
+			config.IRCNickServPassword, //NickServ password
+			config.IRCNickServRecover, //NickServ GHOST or RECOVER
+			false, //registered
+			false, //identified
+			false, //identify pending
+			nil, //NickServ identify timer
+			nil, //pending joins
+			NewSendQueue(), //outbound queue
+			nil, //bufio.Reader
+		}
+		chat = irc
+	}
+
 	log.Println("Testing connectivity to CS server(s)..")
 	
-	if !SetupAndTestCSServers(config.CSServers) {
+	if !SetupAndTestCSServers(config.CSServers, config.CSLogListenAddress, config.CSLogHTTPListenAddress) {
 		return;
 	}
 
-	irc = &IRC{
-		config.IRCServer, //server
-		config.IRCPassword, //password
-		config.IRCNickname,  //nickname
-		config.IRCUsername, //username
-		"", //internal IP
-		"", //external IP
-		config.IRCChannels, //channel
-		nil,  // net.Conn
-		false, //irc connected
-		false, //irc protocol debug
-		Message{},
-		time.Now(), // pingTime
-		false, //ping sent
-		false, //pong received 
-		false, //joined channel
-	}
+	log.Println("Restoring saved PUGs from " + STATE_FILE + "..")
+	LoadState()
+	go RunActions()
 
-	log.Println("Starting main IRC loop..")
-	irc.IRCLoop()
+	log.Println("Starting chat transport..")
+	chat.Run()
 }
-
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+const identifyTimeout = 30 * time.Second
+
+// JoinChannels joins the configured channels along with any channels that refused us earlier
+// because they require a registered nickname.
+func (irc *IRC) JoinChannels() {
+	for i := 0; i < len(irc.ircChannels); i++ {
+		irc.WriteData("JOIN %s %s\r\n", irc.ircChannels[i].Channel, irc.ircChannels[i].Password)
+	}
+	irc.pendingJoins = nil
+	irc.identifyPending = false
+	irc.joinedChannel.Store(true)
+}
+
+// IdentifyNickname identifies with NickServ once registered, holding back the channel joins until
+// NickServ confirms or identifyTimeout passes so +r channels don't refuse us.
+func (irc *IRC) IdentifyNickname() {
+	if len(irc.nickServPassword) == 0 || irc.identified {
+		irc.JoinChannels()
+		return
+	}
+
+	if irc.nickname != irc.configuredNickname {
+		irc.RecoverNickname()
+	}
+
+	irc.identifyPending = true
+	irc.WriteData("PRIVMSG NickServ :IDENTIFY %s %s\r\n", irc.configuredNickname, irc.nickServPassword)
+	irc.StopIdentifyTimer()
+	irc.identifyTimer = time.NewTimer(identifyTimeout)
+}
+
+// IdentifyTimeout fires when NickServ hasn't confirmed the identification within identifyTimeout.
+// The timer belongs to the current connection, RunConnection stops it when the connection ends.
+func (irc *IRC) IdentifyTimeout() <-chan time.Time {
+	if irc.identifyTimer == nil {
+		return nil
+	}
+	return irc.identifyTimer.C
+}
+
+func (irc *IRC) StopIdentifyTimer() {
+	if irc.identifyTimer != nil {
+		irc.identifyTimer.Stop()
+		irc.identifyTimer = nil
+	}
+}
+
+// RecoverNickname asks NickServ to free our configured nickname (using GHOST or RECOVER) and
+// then tries to switch back to it.
+func (irc *IRC) RecoverNickname() {
+	if len(irc.nickServPassword) > 0 && len(irc.nickServRecover) > 0 {
+		irc.WriteData("PRIVMSG NickServ :%s %s %s\r\n", strings.ToUpper(irc.nickServRecover), irc.configuredNickname, irc.nickServPassword)
+		if strings.ToUpper(irc.nickServRecover) == "RECOVER" {
+			irc.WriteData("PRIVMSG NickServ :RELEASE %s %s\r\n", irc.configuredNickname, irc.nickServPassword)
+		}
+	}
+	irc.WriteData("NICK %s\r\n", irc.configuredNickname)
+}
+
+func (irc *IRC) SetIdentified() {
+	if irc.identified {
+		return
+	}
+
+	log.Println("Identified with NickServ.")
+	irc.identified = true
+	if irc.identifyPending {
+		irc.JoinChannels()
+		return
+	}
+
+	for i := range irc.pendingJoins {
+		irc.WriteData("JOIN %s %s\r\n", irc.pendingJoins[i].Channel, irc.pendingJoins[i].Password)
+	}
+	irc.pendingJoins = nil
+}
+
+// HandleNickServ handles the nickname related replies from the IRC server and NickServ.
+func (irc *IRC) HandleNickServ(match []string) {
+	switch match[2] {
+		case "NOTICE":
+			if !strings.HasPrefix(strings.ToLower(match[1]), "nickserv!") {
+				return
+			}
+
+			notice := strings.ToLower(match[4])
+			if strings.Contains(notice, "you are now identified") || strings.Contains(notice, "password accepted") || strings.Contains(notice, "you are now recognized") {
+				irc.SetIdentified()
+			}
+		case "900":
+			irc.SetIdentified()
+		case "433":
+			if irc.registered {
+				log.Printf("Unable to reclaim nickname %s, it is still in use.\n", irc.configuredNickname)
+				return
+			}
+			irc.nickname = irc.nickname + "`"
+			irc.WriteData("NICK %s\r\n", irc.nickname)
+		case "477":
+			params := strings.Fields(match[3])
+			for i := range irc.ircChannels {
+				if len(params) > 1 && strings.EqualFold(irc.ircChannels[i].Channel, params[1]) {
+					log.Printf("Channel %s requires a registered nickname, joining once identified.\n", params[1])
+					irc.pendingJoins = append(irc.pendingJoins, irc.ircChannels[i])
+				}
+			}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+const MAX_TACTICAL_TIMEOUTS = 4
+
+type PauseManager struct {
+	paused, technicalPause bool
+	pausedBy string
+	ctReady, tReady bool
+	ctTimeouts, tTimeouts int
+}
+
+func (pm *PauseManager) Paused() (bool) {
+	return pm.paused
+}
+
+func (pm *PauseManager) TechnicalPause() (bool) {
+	return pm.technicalPause
+}
+
+func (pm *PauseManager) GetPausedBy() (string) {
+	return pm.pausedBy
+}
+
+func (pm *PauseManager) Pause(team string, technical bool) {
+	pm.paused = true
+	pm.technicalPause = technical
+	pm.pausedBy = team
+	pm.ctReady = false
+	pm.tReady = false
+}
+
+func (pm *PauseManager) Unpause() {
+	pm.paused = false
+	pm.technicalPause = false
+	pm.pausedBy = ""
+	pm.ctReady = false
+	pm.tReady = false
+}
+
+// SetTeamReady marks a team as ready to resume and returns true once both teams are ready.
+func (pm *PauseManager) SetTeamReady(team string) (bool) {
+	switch team {
+		case "CT":
+			pm.ctReady = true
+		case "TERRORIST":
+			pm.tReady = true
+	}
+	return pm.ctReady && pm.tReady
+}
+
+func (pm *PauseManager) GetTimeoutsLeft(team string) (int) {
+	if team == "CT" {
+		return MAX_TACTICAL_TIMEOUTS - pm.ctTimeouts
+	}
+	return MAX_TACTICAL_TIMEOUTS - pm.tTimeouts
+}
+
+func (pm *PauseManager) UseTimeout(team string) (bool) {
+	if pm.GetTimeoutsLeft(team) <= 0 {
+		return false
+	}
+
+	if team == "CT" {
+		pm.ctTimeouts++
+	} else {
+		pm.tTimeouts++
+	}
+	return true
+}
+
+func (pm *PauseManager) Reset() {
+	pm.Unpause()
+	pm.ctTimeouts = 0
+	pm.tTimeouts = 0
+}
+
+func (cs *CS) HandlePauseCommand(command, player, steamID, team string) {
+	// the logged in admin may pause and unpause from anywhere, e.g. as a spectator
+	onTeam := team == "CT" || team == "TERRORIST"
+	if !onTeam && cs.authSteamID != steamID {
+		cs.Say("Only players on a team can pause the match.")
+		return
+	}
+
+	switch command {
+		case "pause":
+			if cs.pm.Paused() {
+				cs.Say("The match is already paused.")
+				return
+			}
+			pausedBy := "PUG admin"
+			if onTeam {
+				pausedBy = GetTeamDisplayName(team)
+			}
+			cs.pm.Pause(pausedBy, true)
+			cs.WriteData("mp_pause_match")
+			cs.Say("%s called a technical pause. The match will pause at the end of the round.", player)
+			cs.SendToChannel("*** %s (%s) called a technical pause.", player, pausedBy)
+		case "timeout":
+			if !onTeam {
+				cs.Say("Only players on a team can call a tactical timeout.")
+				return
+			}
+			if cs.pm.Paused() {
+				cs.Say("The match is already paused.")
+				return
+			}
+			if !cs.pm.UseTimeout(team) {
+				cs.Say("The %s have no tactical timeouts left.", GetTeamDisplayName(team))
+				return
+			}
+			if team == "CT" {
+				cs.WriteData("timeout_ct_start")
+			} else {
+				cs.WriteData("timeout_terrorist_start")
+			}
+			cs.Say("%s called a tactical timeout for the %s (%d left).", player, GetTeamDisplayName(team), cs.pm.GetTimeoutsLeft(team))
+			cs.SendToChannel("*** %s called a tactical timeout for the %s (%d left).", player, GetTeamDisplayName(team), cs.pm.GetTimeoutsLeft(team))
+		case "unpause":
+			if !cs.pm.Paused() {
+				return
+			}
+			if cs.authSteamID != steamID && !cs.pm.SetTeamReady(team) {
+				cs.Say("The %s are ready. Waiting for the other team to type %s.", GetTeamDisplayName(team), Cmd("ready"))
+				return
+			}
+			cs.pm.Unpause()
+			cs.WriteData("mp_unpause_match")
+			cs.Say("Both teams are ready, unpausing the match.")
+			cs.SendToChannel("*** The match has been unpaused.")
+	}
+}
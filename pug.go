@@ -11,15 +11,20 @@ import (
 const MAX_PLAYERS = 10
 var validMaps, teamName []string
 var pugManager []*PUG
+var nextPugID int
 var teamNameCT, teamNameT string
 
 type PUG struct {
 	pugID int
+	// number identifies the PUG among the PUGs in its channel, starting at 1
+	number int
 	mapName string
 	ircChannel string
 	players[] string
 	pugAdmin string
 	pugStarted, pugActive bool
+	steamIDs map[string]string
+	captainT, captainCT string
 }
 
 func SetAllowedMaps(maps []string)  {
@@ -43,27 +48,63 @@ func GetPugCounter() (int) {
 	return len(pugManager)
 }
 
+// NewPug registers a PUG, giving it a unique ID and the lowest number not in use in its channel.
 func NewPug(pug *PUG) {
-	if (len(pugManager) == 0) {
-		pug.pugID = 0
-	} else {
-		pug.pugID = len(pugManager)
+	nextPugID++
+	pug.pugID = nextPugID
+	pug.number = 1
+	for {
+		if _, exists := GetPugByNumber(pug.GetIRCChannel(), pug.number); !exists {
+			break
+		}
+		pug.number++
 	}
 	pugManager = append(pugManager, pug)
 }
 
-func GetPugByPlayer(player string) (*PUG, bool) {
+func GetPugByID(pugID int) (*PUG, bool) {
+	for i := range pugManager {
+		if pugManager[i].GetPugID() == pugID {
+			return pugManager[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetPugsByPlayer returns every PUG a player is in, a player can queue for several PUGs at once.
+func GetPugsByPlayer(player string) []*PUG {
+	var pugs []*PUG
 	for i := range pugManager {
 		if pugManager[i].GetPlayerByName(player) {
+			pugs = append(pugs, pugManager[i])
+		}
+	}
+	return pugs
+}
+
+// GetActivePugByPlayer returns the PUG a player is playing in, if it has gone active.
+func GetActivePugByPlayer(player string) (*PUG, bool) {
+	for i := range pugManager {
+		if pugManager[i].PugActive() && pugManager[i].GetPlayerByName(player) {
 			return pugManager[i], true
 		}
 	}
 	return nil, false
 }
 
-func GetPugByChannel(channel string) (*PUG, bool) {
+func GetPugsByChannel(channel string) []*PUG {
+	var pugs []*PUG
 	for i := range pugManager {
 		if pugManager[i].GetIRCChannel() == channel {
+			pugs = append(pugs, pugManager[i])
+		}
+	}
+	return pugs
+}
+
+func GetPugByNumber(channel string, number int) (*PUG, bool) {
+	for i := range pugManager {
+		if pugManager[i].GetIRCChannel() == channel && pugManager[i].GetNumber() == number {
 			return pugManager[i], true
 		}
 	}
@@ -159,11 +200,86 @@ func (p *PUG) UpdatePlayerNickname(oldNick string, newNick string) {
 			if (p.pugAdmin == oldNick) {
 				p.pugAdmin = newNick
 			}
+			if (p.captainT == oldNick) {
+				p.captainT = newNick
+			}
+			if (p.captainCT == oldNick) {
+				p.captainCT = newNick
+			}
+			if steamID, linked := p.steamIDs[oldNick]; linked {
+				delete(p.steamIDs, oldNick)
+				p.steamIDs[newNick] = steamID
+			}
 			break;
 		}
 	}
 }
 
+func (p *PUG) LinkSteamID(player, steamID string) bool {
+	if !p.GetPlayerByName(player) {
+		return false
+	}
+
+	if (p.steamIDs == nil) {
+		p.steamIDs = make(map[string]string)
+	}
+
+	for nick := range p.steamIDs {
+		if (SameSteamID(p.steamIDs[nick], steamID) && nick != player) {
+			return false
+		}
+	}
+
+	p.steamIDs[player] = steamID
+	return true
+}
+
+func (p *PUG) GetSteamID(player string) (string, bool) {
+	steamID, linked := p.steamIDs[player]
+	return steamID, linked
+}
+
+func (p *PUG) GetPlayerBySteamID(steamID string) (string, bool) {
+	for nick := range p.steamIDs {
+		if (SameSteamID(p.steamIDs[nick], steamID)) {
+			return nick, true
+		}
+	}
+	return "", false
+}
+
+// SetCaptains picks the first player of each team, the player list is split
+// in half with the Terrorists first.
+func (p *PUG) SetCaptains() {
+	if (len(p.players) == 0) {
+		return
+	}
+
+	half := (len(p.players) + 1) / 2
+	p.captainT = p.players[0]
+	if (half < len(p.players)) {
+		p.captainCT = p.players[half]
+	}
+}
+
+func (p *PUG) GetCaptainT() string {
+	return p.captainT
+}
+
+func (p *PUG) GetCaptainCT() string {
+	return p.captainCT
+}
+
+func (p *PUG) IsCaptain(player string) bool {
+	return len(player) > 0 && (player == p.captainT || player == p.captainCT)
+}
+
+func (p *PUG) CaptainsLinked() bool {
+	_, linkedT := p.steamIDs[p.captainT]
+	_, linkedCT := p.steamIDs[p.captainCT]
+	return linkedT && linkedCT
+}
+
 func (p *PUG) LeavePug(player string) bool {
 	if (!p.pugStarted) {
 		return false
@@ -172,6 +288,7 @@ func (p *PUG) LeavePug(player string) bool {
 	for i := range p.players {
 		if (player == p.players[i]) {
 			p.players = append(p.players[:i], p.players[i+1:]...)
+			delete(p.steamIDs, player)
 			return true
 		}
 	}
@@ -182,6 +299,10 @@ func (p *PUG) GetPugID() (int) {
 	return p.pugID
 }
 
+func (p *PUG) GetNumber() (int) {
+	return p.number
+}
+
 func (p *PUG) SetMap(mapName string) {
 	p.mapName = mapName
 }
@@ -194,6 +315,36 @@ func (p *PUG) GetAdmin() string {
 	return p.pugAdmin
 }
 
+func (p *PUG) SetAdmin(player string) bool {
+	if !p.GetPlayerByName(player) {
+		return false
+	}
+
+	p.pugAdmin = player
+	return true
+}
+
+func (p *PUG) SwapPlayers(playerA, playerB string) bool {
+	a, b := -1, -1
+	for i := range p.players {
+		if (p.players[i] == playerA) {
+			a = i
+		} else if (p.players[i] == playerB) {
+			b = i
+		}
+	}
+
+	if (a == -1 || b == -1) {
+		return false
+	}
+
+	p.players[a], p.players[b] = p.players[b], p.players[a]
+	if (p.captainT == playerA || p.captainCT == playerA || p.captainT == playerB || p.captainCT == playerB) {
+		p.SetCaptains()
+	}
+	return true
+}
+
 func (p *PUG) SetIRCChannel(channel string) {
 	p.ircChannel = channel
 }
@@ -230,6 +381,9 @@ func (p *PUG) EndPug() {
 	p.mapName = ""
 	p.players = nil
 	p.ircChannel = ""
+	p.steamIDs = nil
+	p.captainT = ""
+	p.captainCT = ""
 }
 
 func SetTeamName(names []string) {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -9,18 +10,18 @@ import (
 	"sync"
 	"log"
 	"fmt"
-	"sync/atomic"
 	"time"
 )
 
 const (
 	SERVERDATA_AUTH = 3
 	SERVERDATA_EXECCOMMAND = 2
-	SERVERDATA_AUTH_RESPONSE = 0
-	SERVERDATA_RESPONSE_VALUE = 2
+	SERVERDATA_AUTH_RESPONSE = 2
+	SERVERDATA_RESPONSE_VALUE = 0
 )
 
 const readBufferSize = 4110
+const execTimeout = 10 * time.Second
 
 // RCON Protocol specs can be found here: https://developer.valvesoftware.com/wiki/Source_RCON_Protocol
 // Thanks to https://github.com/james4k/ (james4k) for some of the RCON functions
@@ -29,6 +30,8 @@ type RemoteConsole struct {
 	conn      net.Conn
 	readbuf   []byte
 	readmu    sync.Mutex
+	execmu    sync.Mutex
+	writemu   sync.Mutex
 	reqid     int32
 	queuedbuf []byte
 }
@@ -59,6 +62,62 @@ func (r *RemoteConsole) Read() (response string, requestId int, err error) {
 	return
 }
 
+// Exec runs a command and returns its output once every packet of the reply has arrived. The
+// server doesn't mark the last packet of a reply, so an empty SERVERDATA_RESPONSE_VALUE packet is
+// sent after the command; the server echoes it back after the command's output, which ends the
+// reply. Replies to other requests, such as commands sent with WriteData, are discarded. Only one
+// Exec runs at a time.
+func (r *RemoteConsole) Exec(ctx context.Context, cmd string) (string, error) {
+	r.execmu.Lock()
+	defer r.execmu.Unlock()
+
+	reqid, err := r.writeCmd(SERVERDATA_EXECCOMMAND, cmd)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Sent(RCON): %s\n", cmd)
+
+	sentinel, err := r.writeCmd(SERVERDATA_RESPONSE_VALUE, "")
+	if err != nil {
+		return "", err
+	}
+
+	// unblock the read if the context is cancelled while waiting for the server
+	stop := context.AfterFunc(ctx, func() {
+		r.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	timeout := execTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	var response bytes.Buffer
+	for {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		respType, requestId, data, err := r.readResponse(timeout)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if requestId == sentinel {
+			return response.String(), nil
+		}
+
+		if requestId == reqid && respType == SERVERDATA_RESPONSE_VALUE {
+			response.Write(data)
+		}
+	}
+}
+
 func (r *RemoteConsole) Close() error {
 	return r.conn.Close()
 }
@@ -71,10 +130,13 @@ func newRequestId(id int32) int32 {
 }
 
 func (r *RemoteConsole) writeCmd(cmdType int32, str string) (int, error) {
+	// commands are written from several goroutines, the lock keeps request IDs unique and packets whole
+	r.writemu.Lock()
+	defer r.writemu.Unlock()
+
 	buffer := bytes.NewBuffer(make([]byte, 0, 14+len(str)))
-	reqid := atomic.LoadInt32(&r.reqid)
-	reqid = newRequestId(reqid)
-	atomic.StoreInt32(&r.reqid, reqid)
+	r.reqid = newRequestId(r.reqid)
+	reqid := r.reqid
 
 	binary.Write(buffer, binary.LittleEndian, int32(10+len(str)))
 	binary.Write(buffer, binary.LittleEndian, int32(reqid))
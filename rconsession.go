@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	rconKeepaliveInterval = 30 * time.Second
+	rconMinBackoff = time.Second
+	rconMaxBackoff = 2 * time.Minute
+	// commands kept while the server is unreachable before new ones are dropped
+	maxPendingCommands = 100
+)
+
+var ErrRconUnavailable = errors.New("rcon: server is unreachable")
+
+// RconSession owns the RCON connection to a server. Commands are queued and written by a
+// background goroutine that keeps the connection alive and reconnects with exponential backoff,
+// so a server going down never blocks the goroutine handling chat and log events.
+type RconSession struct {
+	cs *CS
+	mu sync.Mutex
+	rc *RemoteConsole
+	commands chan string
+}
+
+func NewRconSession(cs *CS) *RconSession {
+	s := &RconSession{}
+	s.cs = cs
+	s.commands = make(chan string, maxPendingCommands)
+	return s
+}
+
+func (s *RconSession) Send(command string) {
+	select {
+		case s.commands <- command:
+		default:
+			log.Printf("RCON queue for %s is full, dropping: %s\n", s.cs.serverIP, command)
+	}
+}
+
+// Exec runs a command and waits for its output, failing straight away if the server is down. Any
+// error drops the connection, a timeout can leave part of a reply unread which would be mistaken
+// for the reply to the next command.
+func (s *RconSession) Exec(ctx context.Context, command string) (string, error) {
+	rc := s.GetConsole()
+	if rc == nil {
+		return "", ErrRconUnavailable
+	}
+
+	response, err := rc.Exec(ctx, command)
+	if err != nil {
+		s.Disconnect(rc, err)
+	}
+	return response, err
+}
+
+func (s *RconSession) GetConsole() *RemoteConsole {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rc
+}
+
+func (s *RconSession) SetConsole(rc *RemoteConsole) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rc = rc
+}
+
+// Disconnect drops a connection that failed, unless it has already been replaced.
+func (s *RconSession) Disconnect(rc *RemoteConsole, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rc != rc {
+		return
+	}
+
+	log.Printf("Lost the RCON connection to %s. Error: %s\n", s.cs.serverIP, err)
+	rc.Close()
+	s.rc = nil
+
+	cs := s.cs
+	After(0, func() {
+		if cs.InUse {
+			cs.SendToChannel("*** The server is unreachable, reconnecting..")
+		}
+	})
+}
+
+func (s *RconSession) Run() {
+	keepalive := time.NewTicker(rconKeepaliveInterval)
+	defer keepalive.Stop()
+
+	backoff := rconMinBackoff
+	pending := ""
+
+	for {
+		rc := s.GetConsole()
+		if rc == nil {
+			if !s.cs.ConnectToRcon() {
+				log.Printf("Unable to reconnect to RCON: %s. Trying again in %s.\n", s.cs.serverIP, backoff)
+				time.Sleep(backoff)
+				backoff *= 2
+				if backoff > rconMaxBackoff {
+					backoff = rconMaxBackoff
+				}
+				continue
+			}
+
+			log.Printf("Restablished connection to server RCON %s.\n", s.cs.serverIP)
+			backoff = rconMinBackoff
+			cs := s.cs
+			After(0, func() {
+				// the server may have restarted and forgotten where to send its logs
+				cs.EnableLogging()
+				if cs.InUse {
+					cs.SendToChannel("*** The server is reachable again.")
+				}
+			})
+			continue
+		}
+
+		if len(pending) > 0 {
+			if _, err := rc.WriteData("%s", pending); err != nil {
+				s.Disconnect(rc, err)
+				continue
+			}
+			pending = ""
+		}
+
+		select {
+			case command := <-s.commands:
+				if _, err := rc.WriteData("%s", command); err != nil {
+					pending = command
+					s.Disconnect(rc, err)
+				}
+			case <-keepalive.C:
+				// the keepalive also reads away the replies to commands sent with WriteData
+				ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+				_, err := rc.Exec(ctx, "echo")
+				cancel()
+				if err != nil {
+					s.Disconnect(rc, err)
+				}
+		}
+	}
+}
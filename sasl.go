@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"log"
+	"strings"
+)
+
+const saslChunkSize = 400
+
+// NewTLSConfig builds the TLS configuration for the IRC connection, returning nil when TLS is disabled.
+func NewTLSConfig(config Config) (*tls.Config, error) {
+	if !config.IRCTLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	tlsConfig.ServerName = strings.Split(config.IRCServer, ":")[0]
+	tlsConfig.InsecureSkipVerify = config.IRCTLSSkipVerify
+
+	if len(config.IRCTLSCertFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(config.IRCTLSCertFile, config.IRCTLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// HandleSASL performs IRCv3 CAP negotiation and SASL PLAIN or EXTERNAL authentication.
+func (irc *IRC) HandleSASL(match []string) {
+	switch match[2] {
+		case "CAP":
+			params := strings.Fields(match[3])
+			if len(params) < 2 {
+				return
+			}
+
+			if params[1] == "ACK" && strings.Contains(match[4], "sasl") {
+				irc.WriteData("AUTHENTICATE %s\r\n", strings.ToUpper(irc.saslMechanism))
+			} else if params[1] == "NAK" {
+				log.Println("The IRC server does not support SASL, continuing without it.")
+				irc.WriteData("CAP END\r\n")
+			}
+		case "AUTHENTICATE":
+			if match[3] != "+" {
+				return
+			}
+
+			if strings.ToUpper(irc.saslMechanism) == "EXTERNAL" {
+				irc.WriteData("AUTHENTICATE +\r\n")
+				return
+			}
+
+			payload := base64.StdEncoding.EncodeToString([]byte(irc.saslUsername + "\x00" + irc.saslUsername + "\x00" + irc.saslPassword))
+			for len(payload) >= saslChunkSize {
+				irc.WriteData("AUTHENTICATE %s\r\n", payload[:saslChunkSize])
+				payload = payload[saslChunkSize:]
+			}
+
+			if len(payload) == 0 {
+				payload = "+"
+			}
+			irc.WriteData("AUTHENTICATE %s\r\n", payload)
+		case "900":
+			log.Printf("Logged in to IRC services: %s\n", match[4])
+		case "903":
+			log.Println("SASL authentication successful.")
+			irc.WriteData("CAP END\r\n")
+		case "902", "904", "905", "906":
+			log.Printf("SASL authentication failed: %s\n", match[4])
+			irc.WriteData("CAP END\r\n")
+	}
+}
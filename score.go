@@ -1,6 +1,13 @@
 package main
 
-import "log"
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+const MATCH_HISTORY_FILE = "match_history.json"
 
 type Player struct {
 	steamID, username, team string
@@ -19,8 +26,25 @@ const (
 	MATCH_FINISHED
 )
 
+type MatchRecord struct {
+	Date time.Time
+	Map string
+	FirstHalfCT, FirstHalfT, SecondHalfCT, SecondHalfT int
+	ForfeitedBy string
+	Players []PlayerRecord
+}
+
+type PlayerRecord struct {
+	SteamID, Username string
+	Kills, Deaths, BombPlanted, BombDefused int
+}
+
 type ScoreManager struct {
 	firstHalfStarted, secondHalfStarted, matchCompleted bool
+	knifeRoundStarted bool
+	knifeWinner string
+	forfeitVotes map[string]string
+	forfeitTeam string
 	firstHalfT, firstHalfCT int
 	players []Player
 	playersStatsFirstHalf []Player
@@ -74,6 +98,15 @@ func (sm *ScoreManager) DoesPlayerExist(steamID, username string) (bool) {
 	return false
 }
 
+func (sm *ScoreManager) GetPlayerStats(steamID, username string) (Player, bool) {
+	for i := range sm.players {
+		if sm.players[i].steamID == steamID && steamID != "BOT" || sm.players[i].steamID == "BOT" && sm.players[i].username == username {
+			return sm.players[i], true
+		}
+	}
+	return Player{}, false
+}
+
 func (sm *ScoreManager) AddEventStatsAll(eventType int) {
 	for i := range sm.players {
 		switch eventType {
@@ -152,11 +185,121 @@ func (sm *ScoreManager) EnumerateStats() {
 }
 
 func (sm *ScoreManager) PreservePlayerStatsFirstHalf() {
-	copy(sm.playersStatsFirstHalf, sm.players)
+	sm.playersStatsFirstHalf = append([]Player(nil), sm.players...)
+}
+
+// GetMatchPlayerRecords returns the stats of both halves added together.
+func (sm *ScoreManager) GetMatchPlayerRecords() []PlayerRecord {
+	records := GetPlayerRecords(sm.playersStatsFirstHalf)
+	for _, current := range GetPlayerRecords(sm.players) {
+		found := false
+		for i := range records {
+			if records[i].SteamID == current.SteamID && (current.SteamID != "BOT" || records[i].Username == current.Username) {
+				records[i].Kills += current.Kills
+				records[i].Deaths += current.Deaths
+				records[i].BombPlanted += current.BombPlanted
+				records[i].BombDefused += current.BombDefused
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			records = append(records, current)
+		}
+	}
+	return records
 }
 
-func (sm *ScoreManager) SaveMatchData() {
-	//todo
+func GetPlayerRecords(players []Player) []PlayerRecord {
+	var records []PlayerRecord
+	for i := range players {
+		records = append(records, PlayerRecord{players[i].steamID, players[i].username, players[i].kills, players[i].deaths, players[i].bombPlanted, players[i].bombDefused})
+	}
+	return records
+}
+
+func GetPlayersFromRecords(records []PlayerRecord) []Player {
+	var players []Player
+	for _, p := range records {
+		players = append(players, Player{steamID: p.SteamID, username: p.Username, kills: p.Kills, deaths: p.Deaths, bombPlanted: p.BombPlanted, bombDefused: p.BombDefused})
+	}
+	return players
+}
+
+// SaveMatchData appends the result of the completed match to the match history file.
+func (sm *ScoreManager) SaveMatchData(mapName string) {
+	record := MatchRecord{}
+	record.Date = time.Now()
+	record.Map = mapName
+	// the first half scores move to firstHalfCT and firstHalfT at halftime, a forfeit during the
+	// break leaves the second half at 0-0
+	if sm.secondHalfStarted || sm.firstHalfCT + sm.firstHalfT == 15 {
+		record.FirstHalfCT = sm.firstHalfCT
+		record.FirstHalfT = sm.firstHalfT
+		record.SecondHalfCT = sm.CTScore
+		record.SecondHalfT = sm.TScore
+	} else {
+		record.FirstHalfCT = sm.CTScore
+		record.FirstHalfT = sm.TScore
+	}
+	record.ForfeitedBy = sm.forfeitTeam
+
+	record.Players = sm.GetMatchPlayerRecords()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Unable to encode match data. Error: %s\n", err)
+		return
+	}
+
+	file, err := os.OpenFile(MATCH_HISTORY_FILE, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Unable to open %s. Error: %s\n", MATCH_HISTORY_FILE, err)
+		return
+	}
+	defer file.Close()
+
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		log.Printf("Unable to save match data. Error: %s\n", err)
+	}
+}
+
+// AddForfeitVote records a forfeit vote for a team, returning false if the player has already voted for it.
+func (sm *ScoreManager) AddForfeitVote(steamID, team string) (bool) {
+	if sm.forfeitVotes == nil {
+		sm.forfeitVotes = make(map[string]string)
+	}
+
+	if sm.forfeitVotes[steamID] == team {
+		return false
+	}
+
+	sm.forfeitVotes[steamID] = team
+	return true
+}
+
+func (sm *ScoreManager) GetForfeitVotes(team string) (int) {
+	votes := 0
+	for steamID := range sm.forfeitVotes {
+		if sm.forfeitVotes[steamID] == team {
+			votes++
+		}
+	}
+	return votes
+}
+
+// ResetForfeitVotes clears the votes when the teams swap sides, as they are recorded by side.
+func (sm *ScoreManager) ResetForfeitVotes() {
+	sm.forfeitVotes = nil
+}
+
+func (sm *ScoreManager) GetForfeitTeam() (string) {
+	return sm.forfeitTeam
+}
+
+func (sm *ScoreManager) SetForfeitTeam(team string) {
+	sm.forfeitTeam = team
 }
 
 func (sm *ScoreManager) FirstHalfStarted() (bool) {
@@ -175,6 +318,22 @@ func (sm *ScoreManager) SetSecondHalfStarted(started bool) {
 	sm.secondHalfStarted = started
 }
 
+func (sm *ScoreManager) KnifeRoundStarted() (bool) {
+	return sm.knifeRoundStarted
+}
+
+func (sm *ScoreManager) SetKnifeRoundStarted(started bool) {
+	sm.knifeRoundStarted = started
+}
+
+func (sm *ScoreManager) GetKnifeWinner() (string) {
+	return sm.knifeWinner
+}
+
+func (sm *ScoreManager) SetKnifeWinner(team string) {
+	sm.knifeWinner = team
+}
+
 func (sm *ScoreManager) MatchCompleted() (bool) {
 	return sm.matchCompleted
 }
@@ -260,6 +419,12 @@ func (sm *ScoreManager) Reset() {
 	sm.secondHalfStarted = false
 	sm.matchCompleted = false
 
+	sm.knifeRoundStarted = false
+	sm.knifeWinner = ""
+
+	sm.forfeitVotes = nil
+	sm.forfeitTeam = ""
+
 	sm.firstHalfT = 0
 	sm.firstHalfCT = 0
 }
\ No newline at end of file
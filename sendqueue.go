@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	PRIORITY_HIGH = iota
+	PRIORITY_PRIVATE
+	PRIORITY_NORMAL
+	PRIORITY_COUNT
+)
+
+const (
+	maxLineLength = 512
+	// room left for the ":nick!user@host " prefix the server adds when relaying our messages
+	hostmaskReserve = 100
+	floodBurst = 5
+	floodInterval = 2 * time.Second
+	// channel and private messages kept while disconnected before the oldest are dropped
+	maxQueuedMessages = 200
+)
+
+// SendQueue holds outgoing IRC lines by priority and paces them with a token bucket so the bot
+// isn't flood-kicked when a round produces a burst of messages.
+type SendQueue struct {
+	mu sync.Mutex
+	lines [PRIORITY_COUNT][]string
+	wake chan struct{}
+	tokens float64
+	lastRefill time.Time
+}
+
+func NewSendQueue() *SendQueue {
+	q := &SendQueue{}
+	q.wake = make(chan struct{}, 1)
+	q.tokens = floodBurst
+	q.lastRefill = time.Now()
+	return q
+}
+
+func (q *SendQueue) Push(priority int, line string) {
+	q.mu.Lock()
+	q.lines[priority] = append(q.lines[priority], line)
+	if priority != PRIORITY_HIGH && len(q.lines[PRIORITY_PRIVATE]) + len(q.lines[PRIORITY_NORMAL]) > maxQueuedMessages {
+		dropped := PRIORITY_NORMAL
+		if len(q.lines[PRIORITY_NORMAL]) == 0 {
+			dropped = PRIORITY_PRIVATE
+		}
+		log.Printf("Outbound IRC queue is full, dropping: %s", q.lines[dropped][0])
+		q.lines[dropped] = q.lines[dropped][1:]
+	}
+	q.mu.Unlock()
+
+	select {
+		case q.wake <- struct{}{}:
+		default:
+	}
+}
+
+// Pop returns the oldest line of the highest priority waiting to be sent, ignoring anything with
+// a lower priority than maxPriority.
+func (q *SendQueue) Pop(maxPriority int) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := 0; i <= maxPriority; i++ {
+		if len(q.lines[i]) > 0 {
+			line := q.lines[i][0]
+			q.lines[i] = q.lines[i][1:]
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// Next blocks until a line up to the priority returned by maxPriority can be sent, or the
+// context is cancelled.
+func (q *SendQueue) Next(ctx context.Context, maxPriority func() int) (string, bool) {
+	for {
+		if line, success := q.Pop(maxPriority()); success {
+			return line, true
+		}
+
+		select {
+			case <-q.wake:
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return "", false
+		}
+	}
+}
+
+func (q *SendQueue) Clear(priority int) {
+	q.mu.Lock()
+	q.lines[priority] = nil
+	q.mu.Unlock()
+}
+
+// TakeToken blocks until the token bucket allows another line to be sent.
+func (q *SendQueue) TakeToken() {
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		q.tokens += float64(now.Sub(q.lastRefill)) / float64(floodInterval)
+		if q.tokens > floodBurst {
+			q.tokens = floodBurst
+		}
+		q.lastRefill = now
+
+		if q.tokens >= 1 {
+			q.tokens--
+			q.mu.Unlock()
+			return
+		}
+
+		wait := time.Duration((1 - q.tokens) * float64(floodInterval))
+		q.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// SplitMessage breaks text into chunks of at most max bytes, preferring to split on spaces and
+// never splitting a UTF-8 character.
+func SplitMessage(text string, max int) []string {
+	var chunks []string
+
+	for len(text) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+
+		for i := cut; i > max/2; i-- {
+			if text[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+		if len(text) > 0 && text[0] == ' ' {
+			text = text[1:]
+		}
+	}
+	return append(chunks, text)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+const STATE_FILE = "state.json"
+
+var lastState []byte
+
+// BotState is the snapshot of the PUGs and servers written to STATE_FILE, so a restarted bot can
+// carry on with the queues and matches it was running.
+type BotState struct {
+	NextPugID int
+	Pugs []PugState
+	Servers []ServerState
+}
+
+type PugState struct {
+	ID, Number int
+	Map, Channel, Admin string
+	Players []string
+	Active bool
+	SteamIDs map[string]string
+	CaptainT, CaptainCT string
+}
+
+type ServerState struct {
+	Server string
+	PugID int
+	InUse, RelayGameEvents bool
+	Channel, ServerPassword, PugAdminPassword, AuthSteamID string
+	Score ScoreState
+	Pause PauseState
+}
+
+type ScoreState struct {
+	FirstHalfStarted, SecondHalfStarted, MatchCompleted bool
+	KnifeRoundStarted bool
+	KnifeWinner string
+	ForfeitVotes map[string]string
+	ForfeitTeam string
+	FirstHalfT, FirstHalfCT int
+	CTScore, TScore int
+	CTsLeft, TsLeft int
+	Players, FirstHalfPlayers []PlayerRecord
+}
+
+type PauseState struct {
+	Paused, TechnicalPause bool
+	PausedBy string
+	CTReady, TReady bool
+	CTTimeouts, TTimeouts int
+}
+
+// SaveState writes the current state to STATE_FILE if it has changed since it was last saved. It
+// runs on the owner goroutine after every action.
+func SaveState() {
+	state := BotState{}
+	state.NextPugID = nextPugID
+
+	for _, p := range pugManager {
+		state.Pugs = append(state.Pugs, PugState{p.pugID, p.number, p.mapName, p.ircChannel, p.pugAdmin, p.players, p.pugActive, p.steamIDs, p.captainT, p.captainCT})
+	}
+
+	for _, cs := range csManager {
+		state.Servers = append(state.Servers, ServerState{cs.serverIP, cs.pugID, cs.InUse, cs.RelayGameEvents, cs.ircChannel, cs.serverPassword, cs.pugAdminPassword, cs.authSteamID, cs.sm.GetState(), cs.pm.GetState()})
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Printf("Unable to encode the bot state. Error: %s\n", err)
+		return
+	}
+
+	if bytes.Equal(data, lastState) {
+		return
+	}
+
+	// write to a temporary file first so a crash mid-write doesn't leave a truncated state file
+	if err = ioutil.WriteFile(STATE_FILE + ".tmp", data, 0600); err == nil {
+		err = os.Rename(STATE_FILE + ".tmp", STATE_FILE)
+	}
+
+	if err != nil {
+		log.Printf("Unable to save the bot state to %s. Error: %s\n", STATE_FILE, err)
+		return
+	}
+	lastState = data
+}
+
+// LoadState restores the PUGs and server assignments saved in STATE_FILE. The servers must already
+// have been set up, PUGs whose server is no longer configured are dropped.
+func LoadState() {
+	data, err := ioutil.ReadFile(STATE_FILE)
+	if os.IsNotExist(err) {
+		return
+	}
+
+	if err != nil {
+		log.Printf("Unable to read the bot state from %s. Error: %s\n", STATE_FILE, err)
+		return
+	}
+
+	state := BotState{}
+	if err = json.Unmarshal(data, &state); err != nil {
+		log.Printf("Unable to decode the bot state in %s. Error: %s\n", STATE_FILE, err)
+		return
+	}
+
+	nextPugID = state.NextPugID
+	attached := make(map[int]bool)
+
+	for _, s := range state.Servers {
+		cs, success := GetServerByIP(s.Server)
+		if !success {
+			log.Printf("Server %s in the saved state is no longer configured, ignoring it.\n", s.Server)
+			continue
+		}
+
+		if !s.InUse {
+			continue
+		}
+
+		cs.InUse = true
+		cs.pugID = s.PugID
+		cs.RelayGameEvents = s.RelayGameEvents
+		cs.ircChannel = s.Channel
+		cs.serverPassword = s.ServerPassword
+		cs.pugAdminPassword = s.PugAdminPassword
+		cs.authSteamID = s.AuthSteamID
+		cs.sm.SetState(s.Score)
+		cs.pm.SetState(s.Pause)
+		attached[s.PugID] = true
+		log.Printf("Restored server %s assigned to pug ID %d in %s\n", s.Server, s.PugID, s.Channel)
+	}
+
+	for _, p := range state.Pugs {
+		if !attached[p.ID] {
+			log.Printf("Pug ID %d in the saved state has no server, dropping it.\n", p.ID)
+			continue
+		}
+
+		pug := &PUG{}
+		pug.pugID = p.ID
+		pug.number = p.Number
+		pug.mapName = p.Map
+		pug.ircChannel = p.Channel
+		pug.pugAdmin = p.Admin
+		pug.players = p.Players
+		pug.pugStarted = true
+		pug.pugActive = p.Active
+		pug.steamIDs = p.SteamIDs
+		pug.captainT = p.CaptainT
+		pug.captainCT = p.CaptainCT
+		pugManager = append(pugManager, pug)
+		log.Printf("Restored pug ID %d (#%d in %s) with %d players\n", p.ID, p.Number, p.Channel, len(p.Players))
+	}
+
+	for _, cs := range csManager {
+		if _, success := GetPugByID(cs.pugID); cs.InUse && !success {
+			cs.ReleaseServer()
+		}
+	}
+	lastState = data
+}
+
+func (sm *ScoreManager) GetState() ScoreState {
+	return ScoreState{sm.firstHalfStarted, sm.secondHalfStarted, sm.matchCompleted, sm.knifeRoundStarted, sm.knifeWinner, sm.forfeitVotes, sm.forfeitTeam, sm.firstHalfT, sm.firstHalfCT, sm.CTScore, sm.TScore, sm.CTsLeft, sm.TsLeft, GetPlayerRecords(sm.players), GetPlayerRecords(sm.playersStatsFirstHalf)}
+}
+
+func (sm *ScoreManager) SetState(state ScoreState) {
+	sm.firstHalfStarted = state.FirstHalfStarted
+	sm.secondHalfStarted = state.SecondHalfStarted
+	sm.matchCompleted = state.MatchCompleted
+	sm.knifeRoundStarted = state.KnifeRoundStarted
+	sm.knifeWinner = state.KnifeWinner
+	sm.forfeitVotes = state.ForfeitVotes
+	sm.forfeitTeam = state.ForfeitTeam
+	sm.firstHalfT = state.FirstHalfT
+	sm.firstHalfCT = state.FirstHalfCT
+	sm.CTScore = state.CTScore
+	sm.TScore = state.TScore
+	sm.CTsLeft = state.CTsLeft
+	sm.TsLeft = state.TsLeft
+
+	sm.players = GetPlayersFromRecords(state.Players)
+	sm.playersStatsFirstHalf = GetPlayersFromRecords(state.FirstHalfPlayers)
+}
+
+func (pm *PauseManager) GetState() PauseState {
+	return PauseState{pm.paused, pm.technicalPause, pm.pausedBy, pm.ctReady, pm.tReady, pm.ctTimeouts, pm.tTimeouts}
+}
+
+func (pm *PauseManager) SetState(state PauseState) {
+	pm.paused = state.Paused
+	pm.technicalPause = state.TechnicalPause
+	pm.pausedBy = state.PausedBy
+	pm.ctReady = state.CTReady
+	pm.tReady = state.TReady
+	pm.ctTimeouts = state.CTTimeouts
+	pm.tTimeouts = state.TTimeouts
+}
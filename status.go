@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matches the player lines of status in both the CS:GO ("# userid slot name ...") and older
+// Source ("# userid name ...") layouts
+var statusPlayerRegex = regexp.MustCompile(`^#\s*(\d+)(?:\s+\d+)?\s+"(.*)"\s+(\S+)\s*(.*)$`)
+var statusHumansRegex = regexp.MustCompile(`(\d+) humans?`)
+var statusBotsRegex = regexp.MustCompile(`(\d+) bots?`)
+var statusMaxRegex = regexp.MustCompile(`\((\d+)(?:/\d+)? max\)`)
+var steam2IDRegex = regexp.MustCompile(`^STEAM_[0-5]:([01]):([0-9]+)$`)
+var steam3IDRegex = regexp.MustCompile(`^\[U:1:([0-9]+)\]$`)
+
+type ServerStatus struct {
+	Hostname, Map string
+	Humans, Bots, MaxPlayers int
+	Players []StatusPlayer
+}
+
+type StatusPlayer struct {
+	UserID int
+	Name, SteamID string
+	Ping, Loss int
+	State, Address string
+}
+
+// ParseStatus reads the output of the status command.
+func ParseStatus(output string) ServerStatus {
+	status := ServerStatus{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if match := statusPlayerRegex.FindStringSubmatch(line); match != nil {
+			player := StatusPlayer{}
+			player.UserID, _ = strconv.Atoi(match[1])
+			player.Name = match[2]
+			player.SteamID = match[3]
+			fields := strings.Fields(match[4])
+
+			if player.SteamID == "BOT" {
+				if len(fields) > 0 {
+					player.State = fields[0]
+				}
+			} else if len(fields) >= 4 {
+				// connected ping loss state [rate] address
+				player.Ping, _ = strconv.Atoi(fields[1])
+				player.Loss, _ = strconv.Atoi(fields[2])
+				player.State = fields[3]
+				if address := fields[len(fields)-1]; strings.Contains(address, ":") {
+					player.Address = address
+				}
+			}
+			status.Players = append(status.Players, player)
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+			case "hostname":
+				status.Hostname = value
+			case "map":
+				if fields := strings.Fields(value); len(fields) > 0 {
+					status.Map = fields[0]
+				}
+			case "players":
+				if match := statusHumansRegex.FindStringSubmatch(value); match != nil {
+					status.Humans, _ = strconv.Atoi(match[1])
+				} else if fields := strings.Fields(value); len(fields) > 0 {
+					status.Humans, _ = strconv.Atoi(fields[0])
+				}
+				if match := statusBotsRegex.FindStringSubmatch(value); match != nil {
+					status.Bots, _ = strconv.Atoi(match[1])
+				}
+				if match := statusMaxRegex.FindStringSubmatch(value); match != nil {
+					status.MaxPlayers, _ = strconv.Atoi(match[1])
+				}
+		}
+	}
+	return status
+}
+
+// GetPlayerBySteamID finds a connected player, treating the STEAM_0, STEAM_1 and [U:1:n] forms of
+// a SteamID as the same account.
+func (status ServerStatus) GetPlayerBySteamID(steamID string) (StatusPlayer, bool) {
+	for _, player := range status.Players {
+		if SameSteamID(player.SteamID, steamID) {
+			return player, true
+		}
+	}
+	return StatusPlayer{}, false
+}
+
+func SameSteamID(a, b string) bool {
+	accountA, validA := GetSteamAccountID(a)
+	accountB, validB := GetSteamAccountID(b)
+	if !validA || !validB {
+		return a == b
+	}
+	return accountA == accountB
+}
+
+// GetSteamAccountID returns the account number of a SteamID, STEAM_X:Y:Z is account Z*2+Y and
+// [U:1:N] is account N.
+func GetSteamAccountID(steamID string) (uint64, bool) {
+	if match := steam2IDRegex.FindStringSubmatch(steamID); match != nil {
+		y, _ := strconv.ParseUint(match[1], 10, 64)
+		z, err := strconv.ParseUint(match[2], 10, 64)
+		return z*2 + y, err == nil
+	}
+
+	if match := steam3IDRegex.FindStringSubmatch(steamID); match != nil {
+		account, err := strconv.ParseUint(match[1], 10, 64)
+		return account, err == nil
+	}
+	return 0, false
+}
+
+func (cs *CS) GetStatus() (ServerStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	output, err := cs.rcon.Exec(ctx, "status")
+	if err != nil {
+		return ServerStatus{}, err
+	}
+	return ParseStatus(output), nil
+}
+
+// QueryStatus runs status on another goroutine, as it can take as long as execTimeout, and calls
+// callback with the result on the owner goroutine.
+func (cs *CS) QueryStatus(callback func(ServerStatus, error)) {
+	go func() {
+		status, err := cs.GetStatus()
+		After(0, func() {
+			callback(status, err)
+		})
+	}()
+}
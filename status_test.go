@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const csgoStatus = `hostname: PUG Server
+version : 1.38.0.1/13801 1180/7776 secure  [G:1:123456]
+udp/ip  : 0.0.0.0:27015  (public ip: 1.2.3.4)
+os      :  Linux
+type    :  community dedicated
+map     : de_inferno
+gotv[0]:  port 27020, delay 30.0s, rate 32.0
+players : 2 humans, 1 bot (12/0 max) (not hibernating)
+
+# userid name uniqueid connected ping loss state rate adr
+#  2 1 "alice" STEAM_1:0:111 05:12 35 0 active 786432 10.0.0.5:27005
+#  3 2 "bob the builder" STEAM_1:1:222 01:02:03 80 2 spawning 196608 10.0.0.6:27005
+# 4 3 "BOT Joe" BOT active 64
+#end
+`
+
+const sourceStatus = `hostname: Old PUG Server
+version : 1.0.0.34/7 5135 secure
+udp/ip  :  1.2.3.4:27015
+map     : de_dust2 at: 0 x, 0 y, 0 z
+players : 3 (16 max)
+
+# userid name uniqueid connected ping loss state adr
+#      2 "carl" STEAM_0:0:333 10:05 50 0 active 10.0.0.7:27005
+#      3 "dave "the" dog" STEAM_0:1:444 00:31 120 5 active 10.0.0.8:27005
+#      4 "Bot" BOT active
+`
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		name, output string
+		expected ServerStatus
+	}{
+		{"CS:GO", csgoStatus, ServerStatus{Hostname: "PUG Server", Map: "de_inferno", Humans: 2, Bots: 1, MaxPlayers: 12, Players: []StatusPlayer{
+			{UserID: 2, Name: "alice", SteamID: "STEAM_1:0:111", Ping: 35, Loss: 0, State: "active", Address: "10.0.0.5:27005"},
+			{UserID: 3, Name: "bob the builder", SteamID: "STEAM_1:1:222", Ping: 80, Loss: 2, State: "spawning", Address: "10.0.0.6:27005"},
+			{UserID: 4, Name: "BOT Joe", SteamID: "BOT", State: "active"},
+		}}},
+		{"Source", sourceStatus, ServerStatus{Hostname: "Old PUG Server", Map: "de_dust2", Humans: 3, MaxPlayers: 16, Players: []StatusPlayer{
+			{UserID: 2, Name: "carl", SteamID: "STEAM_0:0:333", Ping: 50, Loss: 0, State: "active", Address: "10.0.0.7:27005"},
+			{UserID: 3, Name: `dave "the" dog`, SteamID: "STEAM_0:1:444", Ping: 120, Loss: 5, State: "active", Address: "10.0.0.8:27005"},
+			{UserID: 4, Name: "Bot", SteamID: "BOT", State: "active"},
+		}}},
+		{"empty", "", ServerStatus{}},
+	}
+
+	for _, test := range tests {
+		if status := ParseStatus(test.output); !reflect.DeepEqual(status, test.expected) {
+			t.Errorf("%s: ParseStatus returned %+v, expected %+v", test.name, status, test.expected)
+		}
+	}
+}
+
+func TestGetSteamAccountID(t *testing.T) {
+	tests := []struct {
+		steamID string
+		account uint64
+		valid bool
+	}{
+		{"STEAM_1:0:111", 222, true},
+		{"STEAM_0:1:222", 445, true},
+		{"[U:1:445]", 445, true},
+		{"STEAM_1:2:111", 0, false},
+		{"[U:1:x]", 0, false},
+		{"[G:1:123456]", 0, false},
+		{"BOT", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		if account, valid := GetSteamAccountID(test.steamID); account != test.account || valid != test.valid {
+			t.Errorf("GetSteamAccountID(%q) returned %d, %v, expected %d, %v", test.steamID, account, valid, test.account, test.valid)
+		}
+	}
+}
+
+func TestSameSteamID(t *testing.T) {
+	tests := []struct {
+		a, b string
+		expected bool
+	}{
+		{"STEAM_0:1:222", "STEAM_1:1:222", true},
+		{"STEAM_1:1:222", "[U:1:445]", true},
+		{"STEAM_1:0:222", "[U:1:445]", false},
+		{"BOT", "BOT", true},
+		{"BOT", "STEAM_1:0:0", false},
+	}
+
+	for _, test := range tests {
+		if same := SameSteamID(test.a, test.b); same != test.expected {
+			t.Errorf("SameSteamID(%q, %q) returned %v, expected %v", test.a, test.b, same, test.expected)
+		}
+	}
+}